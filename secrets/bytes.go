@@ -0,0 +1,169 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WithMaxSize rejects secret files larger than maxSize bytes, without reading them. A
+// secret that grows over the limit keeps its last good value and Err reports
+// ErrSecretTooLarge. There is no limit by default.
+func WithMaxSize(maxSize int64) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.secretConfig.maxSize = maxSize
+	}
+}
+
+// WithSecretMaxSize is like WithMaxSize, for a single secret
+func WithSecretMaxSize(maxSize int64) SecretOption {
+	return func(c *secretConfig) {
+		c.maxSize = maxSize
+	}
+}
+
+// FileOpener can be implemented by a FileReader to stream files, so that the size limit is
+// enforced while reading and a file growing after it was checked is not read fully
+type FileOpener interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// readSecretFile reads a secret file, failing with ErrSecretTooLarge for files over
+// maxSize bytes. A maxSize of 0 or less means no limit.
+func readSecretFile(reader FileReader, path string, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		return reader.ReadFile(path)
+	}
+
+	info, err := reader.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSize {
+		return nil, tooLarge(info.Size(), maxSize)
+	}
+
+	opener, ok := reader.(FileOpener)
+	if !ok {
+		content, err := reader.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) > maxSize {
+			return nil, tooLarge(int64(len(content)), maxSize)
+		}
+		return content, nil
+	}
+
+	file, err := opener.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(&limitedReader{r: file, remaining: maxSize, maxSize: maxSize})
+}
+
+// openSecretFile opens a secret file for streaming, the reader fails with ErrSecretTooLarge
+// once it went over maxSize bytes. Without a FileOpener the file is read into memory first.
+func openSecretFile(reader FileReader, path string, maxSize int64) (io.ReadCloser, error) {
+	opener, ok := reader.(FileOpener)
+	if !ok {
+		content, err := readSecretFile(reader, path, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+
+	if maxSize > 0 {
+		info, err := reader.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() > maxSize {
+			return nil, tooLarge(info.Size(), maxSize)
+		}
+	}
+
+	file, err := opener.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&limitedReader{r: file, remaining: maxSize, maxSize: maxSize}, file}, nil
+}
+
+// limitedReader reads up to maxSize bytes and then fails with ErrSecretTooLarge if there is
+// more, where io.LimitReader would silently truncate the file
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	maxSize   int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// At the limit, read one more byte to tell a file at the limit from a larger one
+		var probe [1]byte
+		n, err := io.ReadFull(l.r, probe[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrSecretTooLarge, l.maxSize)
+		}
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func tooLarge(size, maxSize int64) error {
+	return fmt.Errorf("%w: %d bytes, the limit is %d", ErrSecretTooLarge, size, maxSize)
+}
+
+// Bytes returns a copy of the current value, which the caller may modify
+func (fs *fileSecret) Bytes() []byte {
+	return []byte(fs.value.Get())
+}
+
+// AppendBytes appends the current value to dst and returns the extended slice, so that
+// reading the value into a reused buffer does not allocate
+func (fs *fileSecret) AppendBytes(dst []byte) []byte {
+	return append(dst, fs.value.Get()...)
+}
+
+// Reader opens the secret file for streaming, without holding a copy of a large value in
+// memory. It reads the file as it is now, which may be a newer version than Value if the
+// change was not processed yet, and the size limit of the secret applies while reading.
+// Secrets holding a part of a file stream their current value. The caller must close it.
+func (fs *fileSecret) Reader() (io.ReadCloser, error) {
+	if fs.field != nil {
+		return io.NopCloser(strings.NewReader(fs.value.Get())), nil
+	}
+	file, err := openSecretFile(fs.reader, fs.path, fs.maxSize.Get())
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrReadFailed, fs.path, err)
+	}
+	return file, nil
+}
+
+// SubscribeBytes is like Subscribe, with the new values delivered as the bytes that were
+// read, without converting them back from the string value. The slices are shared by the
+// byte subscribers of the secret and must not be modified.
+func (fs *fileSecret) SubscribeBytes(opts ...SubscribeOption) (*Subscription[[]byte], error) {
+	return subscribe(fs, opts, func(change valueChange) []byte {
+		return change.content
+	})
+}
@@ -0,0 +1,207 @@
+package secrets_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func TestSecret_BinaryValues(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	keytab := []byte{0x05, 0x02, 0x00, 0x00, 0xff, 0xfe, '\n'}
+	mfs.WriteFile("/mnt/secrets_store/krb5.keytab", keytab)
+
+	secret, err := loader.GetSecret("krb5.keytab")
+	require.NoError(t, err)
+	assert.Equal(t, keytab, secret.Bytes())
+
+	// Bytes returns a copy the caller owns
+	secret.Bytes()[0] = 0
+	assert.Equal(t, keytab, secret.Bytes())
+
+	assert.Equal(t, append([]byte("krb5:"), keytab...), secret.AppendBytes([]byte("krb5:")))
+
+	reader, err := secret.Reader()
+	require.NoError(t, err)
+	streamed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, keytab, streamed)
+
+	sub, err := secret.SubscribeBytes()
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	rotated := []byte{0x05, 0x02, 0x00, 0x01, 0x80}
+	mfs.WriteFile("/mnt/secrets_store/krb5.keytab", rotated)
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/krb5.keytab", fsnotify.Write)
+
+	select {
+	case value, ok := <-sub.Changes():
+		require.True(t, ok)
+		assert.Equal(t, rotated, value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	assert.Zero(t, sub.Dropped())
+
+	sub.Unsubscribe()
+	_, open := <-sub.Changes()
+	assert.False(t, open)
+}
+
+func TestSecretLoader_MaxSize(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithMaxSize(8))
+	mfs.WriteFile("/mnt/secrets_store/small", []byte("12345678"))
+	mfs.WriteFile("/mnt/secrets_store/large", []byte("123456789"))
+
+	_, err := loader.GetSecret("large")
+	assert.ErrorIs(t, err, secrets.ErrSecretTooLarge)
+	assert.ErrorIs(t, err, secrets.ErrReadFailed)
+
+	// The limit can be raised for a single secret
+	large, err := loader.GetSecret("large", secrets.WithSecretMaxSize(16))
+	require.NoError(t, err)
+	assert.Equal(t, "123456789", large.Value())
+
+	secret, err := loader.GetSecret("small")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	write := func(content string) {
+		mfs.WriteFile("/mnt/secrets_store/small", []byte(content))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/small", fsnotify.Write)
+	}
+
+	// A file growing over the limit keeps the last good value
+	write("too large now")
+	require.Eventually(t, func() bool { return secret.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, secret.Err(), secrets.ErrSecretTooLarge)
+	assert.Equal(t, "12345678", secret.Value())
+
+	write("fits")
+	select {
+	case value := <-changes:
+		assert.Equal(t, "fits", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	assert.NoError(t, secret.Err())
+}
+
+// streamingFileSystem streams files through Open and reports no size, like procfs, so that
+// only the limited read can catch oversized files
+type streamingFileSystem struct {
+	*mocks.MockFileSystem
+	readFully bool
+}
+
+type sizelessFileInfo struct {
+	fs.FileInfo
+}
+
+func (sizelessFileInfo) Size() int64 { return 0 }
+
+func (s *streamingFileSystem) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.MockFileSystem.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return sizelessFileInfo{info}, nil
+}
+
+func (s *streamingFileSystem) ReadFile(path string) ([]byte, error) {
+	s.readFully = true
+	return s.MockFileSystem.ReadFile(path)
+}
+
+func (s *streamingFileSystem) Open(path string) (io.ReadCloser, error) {
+	content, err := s.MockFileSystem.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func TestSecretLoader_MaxSizeStopsReadingAtLimit(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.CreateDir("/mnt/secrets_store")
+	streaming := &streamingFileSystem{MockFileSystem: mfs}
+	loader, _, _ := newMockLoader(t, secrets.WithFileReader(streaming), secrets.WithMaxSize(1024))
+
+	mfs.WriteFile("/mnt/secrets_store/blob", []byte(strings.Repeat("x", 4096)))
+	mfs.WriteFile("/mnt/secrets_store/key", []byte(strings.Repeat("k", 1024)))
+
+	_, err := loader.GetSecret("blob")
+	assert.ErrorIs(t, err, secrets.ErrSecretTooLarge)
+
+	secret, err := loader.GetSecret("key")
+	require.NoError(t, err)
+	assert.Len(t, secret.Bytes(), 1024)
+	assert.False(t, streaming.readFully)
+}
+
+func TestSecret_ReaderStreamsWithinMaxSize(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.CreateDir("/mnt/secrets_store")
+	streaming := &streamingFileSystem{MockFileSystem: mfs}
+	loader, _, _ := newMockLoader(t, secrets.WithFileReader(streaming), secrets.WithMaxSize(1024))
+
+	mfs.WriteFile("/mnt/secrets_store/blob", []byte(strings.Repeat("x", 1024)))
+	secret, err := loader.GetSecret("blob")
+	require.NoError(t, err)
+
+	reader, err := secret.Reader()
+	require.NoError(t, err)
+	streamed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Len(t, streamed, 1024)
+	assert.False(t, streaming.readFully)
+
+	// The file grew over the limit, and its size is not known before reading it
+	mfs.WriteFile("/mnt/secrets_store/blob", []byte(strings.Repeat("x", 4096)))
+	reader, err = secret.Reader()
+	require.NoError(t, err)
+	defer reader.Close()
+	_, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, secrets.ErrSecretTooLarge)
+	assert.False(t, streaming.readFully)
+
+	mfs.RemoveFile("/mnt/secrets_store/blob")
+	_, err = secret.Reader()
+	assert.ErrorIs(t, err, secrets.ErrReadFailed)
+}
+
+func TestSecretLoader_WaitForSecretsRespectsMaxSize(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.CreateDir("/mnt/secrets_store")
+	streaming := &streamingFileSystem{MockFileSystem: mfs}
+	loader, _, _ := newMockLoader(t, secrets.WithFileReader(streaming), secrets.WithMaxSize(1024))
+
+	mfs.WriteFile("/mnt/secrets_store/blob", []byte(strings.Repeat("x", 4096)))
+
+	// An oversized file is there, GetSecret reports why it cannot be loaded
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, loader.WaitForSecrets(ctx, "blob"))
+	assert.False(t, streaming.readFully)
+
+	_, err := loader.GetSecret("blob")
+	assert.ErrorIs(t, err, secrets.ErrSecretTooLarge)
+}
@@ -0,0 +1,189 @@
+package secrets
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CABundleOption configures a CABundle
+type CABundleOption func(*CABundle)
+
+// WithSystemRoots appends the certificates of the bundle to the system roots instead of
+// trusting only the bundle
+func WithSystemRoots() CABundleOption {
+	return func(b *CABundle) {
+		b.systemRoots = true
+	}
+}
+
+// WithKeyUsages sets the extended key usages the verified certificates must allow. By
+// default, VerifyServer requires x509.ExtKeyUsageServerAuth and VerifyClient requires
+// x509.ExtKeyUsageClientAuth.
+func WithKeyUsages(usages ...x509.ExtKeyUsage) CABundleOption {
+	return func(b *CABundle) {
+		b.keyUsages = usages
+	}
+}
+
+// CABundle serves the latest pool of the CA certificates stored as PEM in a secret, e.g.
+// the ca.crt of a Kubernetes TLS secret. Its verification functions always use the latest
+// pool, so a rotated bundle applies to new connections without recreating the tls.Config.
+type CABundle struct {
+	secret        Secret
+	systemRoots   bool
+	keyUsages     []x509.ExtKeyUsage
+	pool          ConcurrentValue[*x509.CertPool]
+	certificates  ConcurrentValue[[]*x509.Certificate]
+	err           ConcurrentValue[error]
+	reloadMu      sync.Mutex
+	registrations []*Registration
+	closeOnce     sync.Once
+}
+
+// NewCABundle loads the CA bundle stored under the given key. It fails if the bundle does
+// not hold any valid certificate.
+func NewCABundle(loader SecretLoader, secretKey string, opts ...CABundleOption) (*CABundle, error) {
+	secret, err := loader.GetSecret(secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &CABundle{secret: secret}
+	for _, opt := range opts {
+		opt(bundle)
+	}
+
+	bundle.registrations, err = reloadOnChange([]Secret{secret}, bundle.reload)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// reload parses the current bundle and swaps the pool when it is valid. Otherwise the last
+// valid pool is kept and Err reports why the bundle was rejected.
+func (b *CABundle) reload() error {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	certificates, err := parseCertificates([]byte(b.secret.Value()))
+	if err != nil {
+		err = fmt.Errorf("%w: %w", ErrInvalidCABundle, err)
+		b.err.Set(err)
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if b.systemRoots {
+		if pool, err = x509.SystemCertPool(); err != nil {
+			err = fmt.Errorf("%w: failed to load system roots: %w", ErrInvalidCABundle, err)
+			b.err.Set(err)
+			return err
+		}
+	}
+	for _, certificate := range certificates {
+		pool.AddCert(certificate)
+	}
+
+	b.pool.Set(pool)
+	b.certificates.Set(certificates)
+	b.err.Set(nil)
+	return nil
+}
+
+// parseCertificates parses every certificate of a PEM bundle
+func parseCertificates(bundle []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return certificates, nil
+}
+
+// Pool returns the latest pool. It must not be modified.
+func (b *CABundle) Pool() *x509.CertPool {
+	return b.pool.Get()
+}
+
+// Certificates returns the certificates of the latest bundle
+func (b *CABundle) Certificates() []*x509.Certificate {
+	return b.certificates.Get()
+}
+
+// Err returns why the latest bundle was rejected (ErrInvalidCABundle) while the previous
+// pool is still used, nil otherwise
+func (b *CABundle) Err() error {
+	return b.err.Get()
+}
+
+// VerifyServer can be used as tls.Config.VerifyConnection on clients to verify the server
+// against the latest pool. The certificate must be valid for the ServerName of the
+// tls.Config and allow server authentication. The static verification of the tls.Config
+// has to be turned off for it with InsecureSkipVerify, which is safe as long as
+// VerifyServer is set.
+func (b *CABundle) VerifyServer(state tls.ConnectionState) error {
+	if state.ServerName == "" {
+		return errors.New("no server name to verify the server certificate against")
+	}
+	return b.verify(state.PeerCertificates, state.ServerName, x509.ExtKeyUsageServerAuth)
+}
+
+// VerifyClient can be used as tls.Config.VerifyConnection on servers to verify the client
+// against the latest pool. The certificate must allow client authentication. The static
+// verification of the tls.Config has to be turned off for it by setting ClientAuth to
+// RequireAnyClientCert.
+func (b *CABundle) VerifyClient(state tls.ConnectionState) error {
+	return b.verify(state.PeerCertificates, "", x509.ExtKeyUsageClientAuth)
+}
+
+func (b *CABundle) verify(certificates []*x509.Certificate, serverName string, keyUsage x509.ExtKeyUsage) error {
+	if len(certificates) == 0 {
+		return errors.New("peer did not present a certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	keyUsages := b.keyUsages
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{keyUsage}
+	}
+
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         b.pool.Get(),
+		Intermediates: intermediates,
+		DNSName:       serverName,
+		KeyUsages:     keyUsages,
+	})
+	return err
+}
+
+// Close stops reloading the bundle. The last pool is still used.
+func (b *CABundle) Close() {
+	b.closeOnce.Do(func() {
+		for _, registration := range b.registrations {
+			registration.Remove()
+		}
+	})
+}
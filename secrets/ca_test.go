@@ -0,0 +1,162 @@
+package secrets_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func tlsCertificate(t *testing.T, c *testCert) tls.Certificate {
+	t.Helper()
+	certificate, err := tls.X509KeyPair([]byte(c.certPEM), []byte(c.keyPEM))
+	require.NoError(t, err)
+	return certificate
+}
+
+// handshake connects client and server over loopback and returns the errors of both sides
+func handshake(t *testing.T, client, server *tls.Config) (clientErr, serverErr error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		serverDone <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	tlsConn := tls.Client(conn, client)
+	clientErr = tlsConn.Handshake()
+	if clientErr == nil {
+		// With TLS 1.3 the client finishes before the server verified its certificate,
+		// reading surfaces the rejection
+		_ = tlsConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _ = tlsConn.Read(make([]byte, 1))
+	}
+	_ = conn.Close()
+
+	select {
+	case serverErr = <-serverDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the server handshake")
+	}
+	return clientErr, serverErr
+}
+
+func TestCABundle_VerifiesClientsAgainstLatestBundle(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	caA, caB := newTestCA(t, "ca-a"), newTestCA(t, "ca-b")
+	clientA := newTestCert(t, certTemplate("client-a", time.Now().Add(time.Hour)), caA)
+	clientB := newTestCert(t, certTemplate("client-b", time.Now().Add(time.Hour)), caB)
+	server := newTestCert(t, certTemplate("server.example.com", time.Now().Add(time.Hour)), nil)
+
+	mfs.WriteFile("/mnt/secrets_store/ca.crt", []byte(caA.certPEM))
+	bundle, err := secrets.NewCABundle(loader, "ca.crt")
+	require.NoError(t, err)
+	defer bundle.Close()
+	assert.Len(t, bundle.Certificates(), 1)
+
+	// The same server config is used across the rotation
+	serverConfig := &tls.Config{
+		Certificates:     []tls.Certificate{tlsCertificate(t, server)},
+		ClientAuth:       tls.RequireAnyClientCert,
+		VerifyConnection: bundle.VerifyClient,
+	}
+	clientConfig := func(c *testCert) *tls.Config {
+		return &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // only the client certificate is under test
+			Certificates:       []tls.Certificate{tlsCertificate(t, c)},
+		}
+	}
+
+	_, serverErr := handshake(t, clientConfig(clientA), serverConfig)
+	assert.NoError(t, serverErr)
+	_, serverErr = handshake(t, clientConfig(clientB), serverConfig)
+	assert.Error(t, serverErr, "client-b is not signed by the current bundle")
+
+	mfs.WriteFile("/mnt/secrets_store/ca.crt", []byte(caB.certPEM))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/ca.crt", fsnotify.Write)
+	require.Eventually(t, func() bool {
+		certificates := bundle.Certificates()
+		return len(certificates) == 1 && certificates[0].Subject.CommonName == "ca-b"
+	}, time.Second, time.Millisecond)
+
+	_, serverErr = handshake(t, clientConfig(clientB), serverConfig)
+	assert.NoError(t, serverErr)
+	_, serverErr = handshake(t, clientConfig(clientA), serverConfig)
+	assert.Error(t, serverErr, "ca-a was rotated out")
+
+	// Client certificates must allow client authentication
+	serverOnly := certTemplate("server-only", time.Now().Add(time.Hour))
+	serverOnly.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	_, serverErr = handshake(t, clientConfig(newTestCert(t, serverOnly, caB)), serverConfig)
+	assert.Error(t, serverErr, "the certificate does not allow client authentication")
+
+	// A broken bundle is rejected and the previous pool stays in use
+	mfs.WriteFile("/mnt/secrets_store/ca.crt", []byte("-----BEGIN CERTIFICATE-----\ntruncated"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/ca.crt", fsnotify.Write)
+	require.Eventually(t, func() bool { return bundle.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, bundle.Err(), secrets.ErrInvalidCABundle)
+	_, serverErr = handshake(t, clientConfig(clientB), serverConfig)
+	assert.NoError(t, serverErr)
+}
+
+func TestCABundle_VerifiesServers(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	ca := newTestCA(t, "ca")
+	server := newTestCert(t, certTemplate("server.example.com", time.Now().Add(time.Hour)), ca)
+
+	clientOnly := certTemplate("client-only.example.com", time.Now().Add(time.Hour))
+	clientOnly.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	mfs.WriteFile("/mnt/secrets_store/ca.crt", []byte(ca.certPEM))
+
+	bundle, err := secrets.NewCABundle(loader, "ca.crt", secrets.WithSystemRoots())
+	require.NoError(t, err)
+	defer bundle.Close()
+	assert.NotNil(t, bundle.Pool())
+
+	serverConfig := func(c *testCert) *tls.Config {
+		return &tls.Config{Certificates: []tls.Certificate{tlsCertificate(t, c)}}
+	}
+	clientConfig := func(serverName string) *tls.Config {
+		return &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true, //nolint:gosec // verified by the bundle
+			VerifyConnection:   bundle.VerifyServer,
+		}
+	}
+
+	clientErr, _ := handshake(t, clientConfig("server.example.com"), serverConfig(server))
+	assert.NoError(t, clientErr)
+	clientErr, _ = handshake(t, clientConfig("other.example.com"), serverConfig(server))
+	assert.Error(t, clientErr, "the certificate is not valid for the server name")
+	clientErr, _ = handshake(t, clientConfig(""), serverConfig(server))
+	assert.Error(t, clientErr, "the server name is always checked")
+
+	clientErr, _ = handshake(t, clientConfig("client-only.example.com"), serverConfig(newTestCert(t, clientOnly, ca)))
+	assert.Error(t, clientErr, "the certificate does not allow server authentication")
+}
+
+func TestCABundle_RejectsInvalidInitialBundle(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/ca.crt", []byte("not a certificate"))
+
+	_, err := secrets.NewCABundle(loader, "ca.crt")
+	assert.ErrorIs(t, err, secrets.ErrInvalidCABundle)
+}
@@ -0,0 +1,293 @@
+package secrets
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChangeFunc is called with the previous and the new value of a secret
+type ChangeFunc func(oldValue, newValue string)
+
+// KeyChangeFunc is called with the key, the previous and the new value of a secret
+type KeyChangeFunc func(key, oldValue, newValue string)
+
+// CallbackOption configures a callback registered with OnChange
+type CallbackOption func(*callbackConfig)
+
+type callbackConfig struct {
+	timeout time.Duration
+	onError func(key string, err error)
+}
+
+func newCallbackConfig(opts []CallbackOption) callbackConfig {
+	config := callbackConfig{onError: func(string, error) {}}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// WithCallbackTimeout stops waiting for a callback after the timeout, so the next changes
+// are delivered even if the callback hangs. The callback itself cannot be interrupted and
+// keeps running in the background.
+func WithCallbackTimeout(timeout time.Duration) CallbackOption {
+	return func(c *callbackConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithCallbackErrorHandler is called when a callback panicked (ErrCallbackPanic) or did
+// not return in time (ErrCallbackTimeout)
+func WithCallbackErrorHandler(onError func(key string, err error)) CallbackOption {
+	return func(c *callbackConfig) {
+		c.onError = onError
+	}
+}
+
+// Registration is a callback registered with OnChange
+type Registration struct {
+	remove func()
+}
+
+// Remove unregisters the callback. Changes that were queued but not delivered yet are
+// dropped; a callback that is currently running is not interrupted.
+func (r *Registration) Remove() {
+	r.remove()
+}
+
+// keyedChange is a change waiting to be delivered to a callback
+type keyedChange struct {
+	key    string
+	change valueChange
+}
+
+// callbackWorker calls a callback, one change at a time, on its own goroutine so a slow or
+// panicking callback does not hold up reloads
+type callbackWorker struct {
+	fn        KeyChangeFunc
+	config    callbackConfig
+	mu        sync.Mutex
+	queue     []keyedChange
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newCallbackWorker(fn KeyChangeFunc, config callbackConfig) *callbackWorker {
+	w := &callbackWorker{
+		fn:     fn,
+		config: config,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue queues the change and returns false once the worker was stopped
+func (w *callbackWorker) enqueue(key string, change valueChange) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+
+	w.queue = append(w.queue, keyedChange{key: key, change: change})
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (w *callbackWorker) stop() {
+	w.closeOnce.Do(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		close(w.done)
+		w.queue = nil
+	})
+}
+
+func (w *callbackWorker) run() {
+	for {
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+
+		for {
+			w.mu.Lock()
+			if len(w.queue) == 0 {
+				w.mu.Unlock()
+				break
+			}
+			next := w.queue[0]
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+
+			w.call(next)
+		}
+	}
+}
+
+// call runs the callback, recovering from panics and giving up after the timeout
+func (w *callbackWorker) call(c keyedChange) {
+	finished := make(chan error, 1)
+	invoke := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				finished <- fmt.Errorf("%w for secret %s: %v", ErrCallbackPanic, c.key, r)
+				return
+			}
+			finished <- nil
+		}()
+		w.fn(c.key, c.change.oldValue, c.change.newValue)
+	}
+
+	if w.config.timeout <= 0 {
+		invoke()
+		if err := <-finished; err != nil {
+			w.config.onError(c.key, err)
+		}
+		return
+	}
+
+	go invoke()
+	timer := time.NewTimer(w.config.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-finished:
+		if err != nil {
+			w.config.onError(c.key, err)
+		}
+	case <-timer.C:
+		w.config.onError(c.key, fmt.Errorf("%w for secret %s after %s", ErrCallbackTimeout, c.key, w.config.timeout))
+	case <-w.done:
+	}
+}
+
+// callbackListener hands the changes of one secret to a callback worker
+type callbackListener struct {
+	worker *callbackWorker
+	key    string
+	// owned is set when the worker only serves this secret and stops together with it
+	owned bool
+}
+
+func (l *callbackListener) notify(change valueChange) bool {
+	return l.worker.enqueue(l.key, change)
+}
+
+func (l *callbackListener) close() {
+	if l.owned {
+		l.worker.stop()
+	}
+}
+
+// OnChange calls fn with the previous and the new value every time the secret changes
+func (fs *fileSecret) OnChange(fn ChangeFunc, opts ...CallbackOption) (*Registration, error) {
+	worker := newCallbackWorker(func(_, oldValue, newValue string) {
+		fn(oldValue, newValue)
+	}, newCallbackConfig(opts))
+	l := &callbackListener{worker: worker, key: fs.id, owned: true}
+
+	if err := fs.addListener(l); err != nil {
+		worker.stop()
+		return nil, err
+	}
+	return &Registration{remove: func() { fs.unsubscribe(l) }}, nil
+}
+
+// OnChange calls fn every time one of the secrets returned by GetSecret changes, including
+// the secrets loaded after the callback was registered
+func (fsl *fileSecretLoader) OnChange(fn KeyChangeFunc, opts ...CallbackOption) (*Registration, error) {
+	fsl.hooksMu.Lock()
+	defer fsl.hooksMu.Unlock()
+
+	if fsl.isClosed.Get() {
+		return nil, ErrLoaderClosed
+	}
+
+	worker := newCallbackWorker(fn, newCallbackConfig(opts))
+	for _, secret := range fsl.secrets.CopyMap() {
+		if err := secret.addListener(&callbackListener{worker: worker, key: secret.id}); err != nil {
+			fsl.detachHook(worker)
+			worker.stop()
+			return nil, err
+		}
+	}
+	fsl.hooks.Add(worker)
+
+	return &Registration{remove: func() {
+		fsl.hooksMu.Lock()
+		defer fsl.hooksMu.Unlock()
+		fsl.hooks.RemoveFunc(func(w *callbackWorker) bool { return w == worker })
+		fsl.detachHook(worker)
+		worker.stop()
+	}}, nil
+}
+
+// reloadOnChange calls reload once, and again every time one of the secrets changes. The
+// callbacks are registered before the first call, so that a rotation happening in between
+// is not missed. If the first call fails, the callbacks are removed and its error returned.
+func reloadOnChange(secrets []Secret, reload func() error) ([]*Registration, error) {
+	var registrations []*Registration
+	removeAll := func() {
+		for _, registration := range registrations {
+			registration.Remove()
+		}
+	}
+
+	for _, secret := range secrets {
+		registration, err := secret.OnChange(func(_, _ string) {
+			_ = reload()
+		})
+		if err != nil {
+			removeAll()
+			return nil, err
+		}
+		registrations = append(registrations, registration)
+	}
+
+	if err := reload(); err != nil {
+		removeAll()
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// attachHooks registers the loader-wide callbacks on a newly loaded secret
+func (fsl *fileSecretLoader) attachHooks(secret *fileSecret) error {
+	for _, worker := range fsl.hooks.Get() {
+		if err := secret.addListener(&callbackListener{worker: worker, key: secret.id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detachHook removes a loader-wide callback from every loaded secret
+func (fsl *fileSecretLoader) detachHook(worker *callbackWorker) {
+	for _, secret := range fsl.secrets.CopyMap() {
+		secret.removeListeners(func(l listener) bool {
+			cl, ok := l.(*callbackListener)
+			return ok && cl.worker == worker
+		})
+	}
+}
+
+// stopHooks stops the workers of all loader-wide callbacks
+func (fsl *fileSecretLoader) stopHooks() {
+	fsl.hooksMu.Lock()
+	defer fsl.hooksMu.Unlock()
+	for _, worker := range fsl.hooks.Get() {
+		worker.stop()
+	}
+	fsl.hooks.Set(nil)
+}
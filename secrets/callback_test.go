@@ -0,0 +1,179 @@
+package secrets_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+type recordedChange struct {
+	key, oldValue, newValue string
+}
+
+type changeRecorder struct {
+	mu      sync.Mutex
+	changes []recordedChange
+}
+
+func (r *changeRecorder) record(key, oldValue, newValue string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes = append(r.changes, recordedChange{key: key, oldValue: oldValue, newValue: newValue})
+}
+
+func (r *changeRecorder) get() []recordedChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedChange(nil), r.changes...)
+}
+
+func TestSecret_OnChange(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	recorder := &changeRecorder{}
+	registration, err := secret.OnChange(func(oldValue, newValue string) {
+		recorder.record("token", oldValue, newValue)
+	})
+	require.NoError(t, err)
+
+	rotate(t, secret, func(value string) {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	}, 2)
+
+	expected := []recordedChange{{"token", "v0", "v1"}, {"token", "v1", "v2"}}
+	require.Eventually(t, func() bool { return len(recorder.get()) == len(expected) }, time.Second, time.Millisecond)
+	assert.Equal(t, expected, recorder.get())
+
+	registration.Remove()
+	assert.False(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v3"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	require.Eventually(t, func() bool { return secret.Value() == "v3" }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, expected, recorder.get(), "removed callback should not be called")
+}
+
+func TestSecret_OnChangeIsolatesFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		callback    func(release <-chan struct{}) secrets.ChangeFunc
+		opts        []secrets.CallbackOption
+		expectedErr error
+	}{
+		{
+			name: "panicking callback",
+			callback: func(<-chan struct{}) secrets.ChangeFunc {
+				return func(string, string) { panic("boom") }
+			},
+			expectedErr: secrets.ErrCallbackPanic,
+		},
+		{
+			name: "hanging callback",
+			callback: func(release <-chan struct{}) secrets.ChangeFunc {
+				return func(string, string) { <-release }
+			},
+			opts:        []secrets.CallbackOption{secrets.WithCallbackTimeout(10 * time.Millisecond)},
+			expectedErr: secrets.ErrCallbackTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader, mfs, mwf := newMockLoader(t)
+			mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+			secret, err := loader.GetSecret("token")
+			require.NoError(t, err)
+
+			release := make(chan struct{})
+			defer close(release)
+
+			errs := make(chan error, 10)
+			opts := append([]secrets.CallbackOption{secrets.WithCallbackErrorHandler(func(key string, err error) {
+				assert.Equal(t, "token", key)
+				errs <- err
+			})}, tt.opts...)
+			_, err = secret.OnChange(tt.callback(release), opts...)
+			require.NoError(t, err)
+
+			// A well-behaved callback and subscriber keep receiving changes
+			recorder := &changeRecorder{}
+			_, err = secret.OnChange(func(oldValue, newValue string) {
+				recorder.record("token", oldValue, newValue)
+			})
+			require.NoError(t, err)
+			changes, err := secret.ListenChanges()
+			require.NoError(t, err)
+
+			for _, value := range []string{"v1", "v2"} {
+				mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+				mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+				select {
+				case received := <-changes:
+					assert.Equal(t, value, received)
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for secret change notification")
+				}
+			}
+
+			for i := 0; i < 2; i++ {
+				select {
+				case err := <-errs:
+					assert.ErrorIs(t, err, tt.expectedErr)
+				case <-time.After(time.Second):
+					t.Fatal("error handler was not called")
+				}
+			}
+			require.Eventually(t, func() bool { return len(recorder.get()) == 2 }, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestSecretLoader_OnChange(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/a", []byte("a0"))
+	mfs.WriteFile("/mnt/secrets_store/b", []byte("b0"))
+	a, err := loader.GetSecret("a")
+	require.NoError(t, err)
+
+	recorder := &changeRecorder{}
+	registration, err := loader.OnChange(recorder.record)
+	require.NoError(t, err)
+
+	// Secrets loaded after the registration are covered as well
+	b, err := loader.GetSecret("b")
+	require.NoError(t, err)
+
+	write := func(key, value string) {
+		mfs.WriteFile("/mnt/secrets_store/"+key, []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/"+key, fsnotify.Write)
+	}
+	write("a", "a1")
+	require.Eventually(t, func() bool { return a.Value() == "a1" }, time.Second, time.Millisecond)
+	write("b", "b1")
+	require.Eventually(t, func() bool { return b.Value() == "b1" }, time.Second, time.Millisecond)
+
+	expected := []recordedChange{{"a", "a0", "a1"}, {"b", "b0", "b1"}}
+	require.Eventually(t, func() bool { return len(recorder.get()) == len(expected) }, time.Second, time.Millisecond)
+	assert.Equal(t, expected, recorder.get())
+
+	registration.Remove()
+	write("a", "a2")
+	require.Eventually(t, func() bool { return a.Value() == "a2" }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, expected, recorder.get(), "removed callback should not be called")
+
+	loader.Close()
+	_, err = loader.OnChange(recorder.record)
+	assert.ErrorIs(t, err, secrets.ErrLoaderClosed)
+}
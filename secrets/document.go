@@ -0,0 +1,218 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// unmarshalFunc decodes a document into v, like json.Unmarshal
+type unmarshalFunc func(data []byte, v any) error
+
+// unmarshalJSON keeps numbers as json.Number, so that fields are rendered exactly as written
+func unmarshalJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// Document is a secret file holding a structured document, such as a JSON object with the
+// username, password and host of a database
+type Document struct {
+	loader    *fileSecretLoader
+	secret    *fileSecret
+	key       string
+	format    Format
+	unmarshal unmarshalFunc
+}
+
+// GetJSONDocument loads the secret stored under the given key as a JSON document
+func (fsl *fileSecretLoader) GetJSONDocument(secretKey string, opts ...SecretOption) (*Document, error) {
+	return fsl.GetDocument(secretKey, FormatJSON, opts...)
+}
+
+// GetDocument loads the secret stored under the given key as a document of the given
+// format. New values that cannot be decoded are rejected like with a validator.
+func (fsl *fileSecretLoader) GetDocument(secretKey string, format Format, opts ...SecretOption) (*Document, error) {
+	format, err := format.resolve(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	unmarshal, err := format.unmarshaler()
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(slices.Clip(opts), withFormat(format))
+	secret, err := fsl.loadSecret(secretKey, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{loader: fsl, secret: secret, key: secretKey, format: format, unmarshal: unmarshal}, nil
+}
+
+// Format returns the format of the document
+func (d *Document) Format() Format {
+	return d.format
+}
+
+// Secret returns the secret holding the whole document
+func (d *Document) Secret() Secret {
+	return d.secret
+}
+
+// Decode decodes the current document into v, e.g. a pointer to a struct
+func (d *Document) Decode(v any) error {
+	if err := d.unmarshal([]byte(d.secret.Value()), v); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrDecodeFailed, d.secret.id, err)
+	}
+	return nil
+}
+
+// Map decodes the current document into a map
+func (d *Document) Map() (map[string]any, error) {
+	var decoded map[string]any
+	if err := d.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// Field returns a secret holding the field of the document identified by the JSON Pointer
+// (RFC 6901), e.g. "/password" or "/replicas/0/host". String fields hold the string
+// itself, any other field its JSON encoding, whatever the format of the document. The
+// listeners of a field are only notified when that field changes, not when another part of
+// the document does.
+func (d *Document) Field(pointer string, opts ...SecretOption) (Secret, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	field := &fieldProjection{pointer: pointer, tokens: tokens, unmarshal: d.unmarshal}
+	secret, err := d.loader.loadSecret(d.key, field, opts)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// projection selects the part of a file that a secret holds
+type projection interface {
+	// key returns the key of the secret holding the projection of the file fileKey
+	key(fileKey string) string
+	// project returns the part of the content of the file held by the secret id
+	project(id string, content []byte) ([]byte, error)
+}
+
+// fieldProjection extracts a field from the content of a document file
+type fieldProjection struct {
+	pointer   string
+	tokens    []string
+	unmarshal unmarshalFunc
+}
+
+func (p *fieldProjection) key(fileKey string) string {
+	return fileKey + "#" + p.pointer
+}
+
+// project decodes the document and returns the rendered value of the field
+func (p *fieldProjection) project(id string, content []byte) ([]byte, error) {
+	var document any
+	if err := p.unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecodeFailed, id, err)
+	}
+
+	value, ok := resolvePointer(document, p.tokens)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFieldNotFound, id)
+	}
+
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	rendered, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecodeFailed, id, err)
+	}
+	return rendered, nil
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: must be empty or start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// resolvePointer walks the decoded document along the reference tokens
+func resolvePointer(document any, tokens []string) (any, bool) {
+	current := document
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) || strconv.Itoa(index) != token {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// fieldKey is the key of the secret holding a part of a file in the map of loaded secrets.
+// File names cannot contain a NUL byte, so it never collides with the key of a file.
+func fieldKey(fileKey, id string) string {
+	return fileKey + "\x00" + id
+}
+
+// indexPart records the secret of a part of the file fileKey, hooksMu must be held. A secret
+// loaded concurrently for the same part replaces the earlier one, like in the secrets map.
+func (fsl *fileSecretLoader) indexPart(fileKey string, secret *fileSecret) {
+	parts, _ := fsl.parts.Get(fileKey)
+	indexed := make([]*fileSecret, 0, len(parts)+1)
+	for _, part := range parts {
+		if part.id != secret.id {
+			indexed = append(indexed, part)
+		}
+	}
+	fsl.parts.Set(fileKey, append(indexed, secret))
+}
+
+// secretsOfFile returns the loaded secrets backed by the file of the given key: the secret
+// of the file itself and the secrets of its parts
+func (fsl *fileSecretLoader) secretsOfFile(key string) []*fileSecret {
+	parts, _ := fsl.parts.Get(key)
+	secret, ok := fsl.secrets.Get(key)
+	if !ok {
+		return parts
+	}
+	return append([]*fileSecret{secret}, parts...)
+}
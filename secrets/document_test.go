@@ -0,0 +1,133 @@
+package secrets_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func TestDocument_DecodeAndMap(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{"username":"app","password":"p1","port":5432}`))
+
+	doc, err := loader.GetJSONDocument("db.json")
+	require.NoError(t, err)
+
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Port     int    `json:"port"`
+	}
+	require.NoError(t, doc.Decode(&creds))
+	assert.Equal(t, "app", creds.Username)
+	assert.Equal(t, 5432, creds.Port)
+
+	values, err := doc.Map()
+	require.NoError(t, err)
+	assert.Equal(t, "p1", values["password"])
+
+	mfs.WriteFile("/mnt/secrets_store/broken.json", []byte(`{"username":`))
+	_, err = loader.GetJSONDocument("broken.json")
+	assert.ErrorIs(t, err, secrets.ErrDecodeFailed)
+}
+
+func TestDocument_Field(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{
+		"username": "app",
+		"password": "p1",
+		"replicas": [{"host": "db-0", "port": 5432}],
+		"a/b": {"~c": true}
+	}`))
+
+	doc, err := loader.GetJSONDocument("db.json")
+	require.NoError(t, err)
+
+	tests := []struct {
+		pointer  string
+		expected string
+	}{
+		{"/password", "p1"},
+		{"/replicas/0/host", "db-0"},
+		{"/replicas/0/port", "5432"},
+		{"/replicas/0", `{"host":"db-0","port":5432}`},
+		{"/a~1b/~0c", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			field, err := doc.Field(tt.pointer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, field.Value())
+		})
+	}
+
+	for _, pointer := range []string{"/missing", "/replicas/1", "/replicas/01", "/password/x"} {
+		_, err := doc.Field(pointer)
+		assert.ErrorIs(t, err, secrets.ErrFieldNotFound, pointer)
+	}
+	_, err = doc.Field("password")
+	assert.Error(t, err)
+}
+
+func TestDocument_FieldNotifiesOnlyOnItsOwnChanges(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{"username":"app","password":"p1"}`))
+
+	doc, err := loader.GetJSONDocument("db.json")
+	require.NoError(t, err)
+	password, err := doc.Field("/password")
+	require.NoError(t, err)
+	username, err := doc.Field("/username")
+	require.NoError(t, err)
+
+	passwordChanges, err := password.ListenChanges()
+	require.NoError(t, err)
+	usernameChanges, err := username.ListenChanges()
+	require.NoError(t, err)
+	docSub, err := doc.Secret().Subscribe(secrets.LatestValueWins())
+	require.NoError(t, err)
+
+	write := func(content string) {
+		mfs.WriteFile("/mnt/secrets_store/db.json", []byte(content))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/db.json", fsnotify.Write)
+	}
+
+	write(`{"username":"app","password":"p2"}`)
+	select {
+	case value := <-passwordChanges:
+		assert.Equal(t, "p2", value)
+	case <-time.After(time.Second):
+		t.Fatal("password field was not notified")
+	}
+	<-docSub.Changes()
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, drain(usernameChanges), "username did not change")
+	assert.Equal(t, uint64(1), username.Version())
+
+	// A document that cannot be decoded keeps the last good field values
+	write(`{"username":"app","pass`)
+	require.Eventually(t, func() bool { return password.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, password.Err(), secrets.ErrDecodeFailed)
+	assert.Equal(t, "p2", password.Value())
+
+	write(`{"username":"app2","password":"p2"}`)
+	select {
+	case value := <-usernameChanges:
+		assert.Equal(t, "app2", value)
+	case <-time.After(time.Second):
+		t.Fatal("username field was not notified")
+	}
+	require.Eventually(t, func() bool { return password.Err() == nil }, time.Second, time.Millisecond)
+	assert.Empty(t, drain(passwordChanges), "password did not change")
+
+	// Unsubscribing from a field keeps the document file watched
+	sub, err := password.Subscribe()
+	require.NoError(t, err)
+	sub.Unsubscribe()
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/db.json"))
+}
@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WithDotenvFile serves the variables of a dotenv file (KEY=value lines) as secrets of
+// their own, so that GetSecret("DB_PASSWORD") returns the value of DB_PASSWORD. Secret
+// files take precedence over variables with the same key, and with several dotenv files
+// the first one defining a variable wins. The listeners of a variable are only notified
+// when its value changes.
+func WithDotenvFile(secretKey string) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.dotenvFiles = append(fsl.dotenvFiles, secretKey)
+	}
+}
+
+// dotenvVariable extracts a variable from the content of a dotenv file
+type dotenvVariable struct {
+	name string
+}
+
+func (v *dotenvVariable) key(string) string {
+	return v.name
+}
+
+func (v *dotenvVariable) project(id string, content []byte) ([]byte, error) {
+	variables, err := parseDotenv(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecodeFailed, id, err)
+	}
+	value, ok := variables[v.name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFieldNotFound, id)
+	}
+	return []byte(value), nil
+}
+
+// getDotenvSecret returns the secret of a variable defined in one of the dotenv files
+func (fsl *fileSecretLoader) getDotenvSecret(name string, opts []SecretOption) (*fileSecret, error) {
+	for _, file := range fsl.dotenvFiles {
+		secret, err := fsl.loadSecret(file, &dotenvVariable{name: name}, opts)
+		if errors.Is(err, ErrFieldNotFound) || errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		return secret, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// dotenvKeys lists the variables defined in the dotenv files
+func (fsl *fileSecretLoader) dotenvKeys() ([]string, error) {
+	var keys []string
+	for _, file := range fsl.dotenvFiles {
+		variables, err := fsl.readDotenv(file)
+		if err != nil {
+			if errors.Is(err, ErrSecretNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		for name := range variables {
+			keys = append(keys, name)
+		}
+	}
+	return keys, nil
+}
+
+// dotenvVariables reads the variables of every dotenv file that can be read, the first
+// file defining a variable wins
+func (fsl *fileSecretLoader) dotenvVariables() map[string]string {
+	merged := make(map[string]string)
+	for _, file := range fsl.dotenvFiles {
+		variables, err := fsl.readDotenv(file)
+		if err != nil {
+			continue
+		}
+		for name, value := range variables {
+			if _, defined := merged[name]; !defined {
+				merged[name] = value
+			}
+		}
+	}
+	return merged
+}
+
+func (fsl *fileSecretLoader) readDotenv(file string) (map[string]string, error) {
+	filePath := filepath.Join(fsl.basePath, filepath.FromSlash(file))
+	content, err := readSecretFile(fsl.reader, filePath, fsl.secretConfig.maxSize)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, filePath)
+		}
+		return nil, fmt.Errorf("%w %s: %w", ErrReadFailed, filePath, err)
+	}
+	variables, err := parseDotenv(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %w", ErrDecodeFailed, file, err)
+	}
+	return variables, nil
+}
+
+var dotenvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// parseDotenv parses KEY=value lines. Blank lines and lines starting with # are ignored,
+// and a leading "export" is allowed. Values may be single quoted (taken literally), double
+// quoted (with \n, \t, \" and \\ escapes) or unquoted, where a " #" starts a comment.
+// Quoted values may span several lines. Later definitions override earlier ones.
+func parseDotenv(content string) (map[string]string, error) {
+	variables := make(map[string]string)
+	rest := strings.ReplaceAll(content, "\r\n", "\n")
+	line := 0
+
+	for rest != "" {
+		var current string
+		current, rest, _ = strings.Cut(rest, "\n")
+		line++
+
+		trimmed := strings.TrimSpace(current)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if after, ok := strings.CutPrefix(trimmed, "export "); ok {
+			trimmed = strings.TrimLeft(after, " \t")
+		}
+
+		name, value, ok := strings.Cut(trimmed, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !dotenvName.MatchString(name) {
+			return nil, fmt.Errorf("line %d: expected KEY=value", line)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			variables[name] = strings.TrimSpace(value)
+			continue
+		}
+
+		quote := value[0]
+		// The closing quote may be on a later line
+		raw := value[1:]
+		for {
+			end := closingQuote(raw, quote)
+			if end >= 0 {
+				trailing := strings.TrimSpace(raw[end+1:])
+				if trailing != "" && !strings.HasPrefix(trailing, "#") {
+					return nil, fmt.Errorf("line %d: unexpected characters after quoted value", line)
+				}
+				raw = raw[:end]
+				break
+			}
+			if rest == "" {
+				return nil, fmt.Errorf("line %d: unterminated quoted value", line)
+			}
+			var next string
+			next, rest, _ = strings.Cut(rest, "\n")
+			line++
+			raw += "\n" + next
+		}
+
+		if quote == '"' {
+			raw = unescapeDotenv(raw)
+		}
+		variables[name] = raw
+	}
+	return variables, nil
+}
+
+// closingQuote returns the index of the quote ending the value, skipping escaped double quotes
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDotenv(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+}
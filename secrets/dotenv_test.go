@@ -0,0 +1,133 @@
+package secrets_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+const appEnv = `# database
+export DB_USER=app
+DB_PASSWORD="s3cr3t \"quoted\""
+DB_HOST = db.internal # primary
+API_KEY='literal $value # not a comment'
+TLS_KEY="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+EMPTY=
+`
+
+func TestDotenv_Values(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t, secrets.WithDotenvFile("app.env"))
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte(appEnv))
+
+	tests := map[string]string{
+		"DB_USER":     "app",
+		"DB_PASSWORD": `s3cr3t "quoted"`,
+		"DB_HOST":     "db.internal",
+		"API_KEY":     "literal $value # not a comment",
+		"TLS_KEY":     "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"EMPTY":       "",
+	}
+	for key, expected := range tests {
+		secret, err := loader.GetSecret(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, expected, secret.Value(), key)
+	}
+
+	_, err := loader.GetSecret("UNKNOWN")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+
+	keys, err := loader.ListSecretKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"API_KEY", "DB_HOST", "DB_PASSWORD", "DB_USER", "EMPTY", "TLS_KEY", "app.env"}, keys)
+
+	keys, err = loader.ListSecretKeysWithPrefix("DB_")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DB_HOST", "DB_PASSWORD", "DB_USER"}, keys)
+}
+
+func TestDotenv_FilesTakePrecedence(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t, secrets.WithDotenvFile("app.env"), secrets.WithDotenvFile("defaults.env"))
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\n"))
+	mfs.WriteFile("/mnt/secrets_store/defaults.env", []byte("DB_USER=default\nDB_HOST=localhost\n"))
+	mfs.WriteFile("/mnt/secrets_store/DB_HOST", []byte("db.internal"))
+
+	user, err := loader.GetSecret("DB_USER")
+	require.NoError(t, err)
+	assert.Equal(t, "app", user.Value(), "the first dotenv file defining a variable wins")
+
+	host, err := loader.GetSecret("DB_HOST")
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal", host.Value(), "secret files take precedence")
+
+	keys, err := loader.ListSecretKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DB_HOST", "DB_USER", "app.env", "defaults.env"}, keys)
+}
+
+func TestDotenv_NotifiesOnlyChangedKeys(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithDotenvFile("app.env"))
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\nDB_PASSWORD=p1\n"))
+
+	user, err := loader.GetSecret("DB_USER")
+	require.NoError(t, err)
+	password, err := loader.GetSecret("DB_PASSWORD")
+	require.NoError(t, err)
+	userChanges, err := user.ListenChanges()
+	require.NoError(t, err)
+	passwordChanges, err := password.ListenChanges()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\nDB_PASSWORD=p2\n"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/app.env", fsnotify.Write)
+
+	select {
+	case value := <-passwordChanges:
+		assert.Equal(t, "p2", value)
+	case <-time.After(time.Second):
+		t.Fatal("DB_PASSWORD was not notified")
+	}
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, drain(userChanges), "DB_USER did not change")
+
+	// A removed variable keeps its last value and reports the error
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\n"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/app.env", fsnotify.Write)
+	require.Eventually(t, func() bool { return password.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, password.Err(), secrets.ErrFieldNotFound)
+	assert.Equal(t, "p2", password.Value())
+}
+
+func TestDotenv_WaitForSecrets(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithDotenvFile("app.env"))
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_PASSWORD=p1\n"))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/app.env", fsnotify.Create)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, loader.WaitForSecrets(ctx, "DB_PASSWORD"))
+}
+
+func TestDotenv_InvalidFile(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t, secrets.WithDotenvFile("app.env"))
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\nnot a variable\n"))
+
+	_, err := loader.GetSecret("DB_USER")
+	assert.ErrorIs(t, err, secrets.ErrDecodeFailed)
+	assert.ErrorContains(t, err, "line 2")
+
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=\"unterminated\n"))
+	_, err = loader.GetSecret("DB_USER")
+	assert.ErrorIs(t, err, secrets.ErrDecodeFailed)
+}
@@ -0,0 +1,38 @@
+package secrets
+
+import "errors"
+
+var (
+	// ErrSecretNotFound is returned when the file of a secret does not exist
+	ErrSecretNotFound = errors.New("secret file not found")
+	// ErrSecretEmpty is returned when the file of a secret has no content
+	ErrSecretEmpty = errors.New("secret file is empty")
+	// ErrReadFailed is reported when an existing secret file could not be read
+	ErrReadFailed = errors.New("failed to read secret file")
+	// ErrWatcherFailed is reported when the file watcher failed or could not be rebuilt
+	ErrWatcherFailed = errors.New("file watcher failed")
+	// ErrLoaderClosed is returned once the secret loader was closed. When the loader was
+	// closed because its context ended, the error also matches the context error.
+	ErrLoaderClosed = errors.New("secret loader is closed")
+	// ErrSecretClosed is returned once a secret was closed
+	ErrSecretClosed = errors.New("secret is closed")
+	// ErrSecretTooLarge is reported when a secret file exceeds the maximum size, see WithMaxSize
+	ErrSecretTooLarge = errors.New("secret is too large")
+	// ErrValidationFailed is reported when a validator rejected a new value of a secret
+	ErrValidationFailed = errors.New("secret value rejected by validator")
+	// ErrDecodeFailed is reported when a document secret could not be decoded
+	ErrDecodeFailed = errors.New("failed to decode secret document")
+	// ErrFieldNotFound is returned when a field of a document secret does not exist
+	ErrFieldNotFound = errors.New("secret document field not found")
+	// ErrInvalidKeyPair is reported when a certificate and its key do not form a valid pair
+	ErrInvalidKeyPair = errors.New("invalid certificate and key pair")
+	// ErrInvalidCABundle is reported when a CA bundle does not hold any valid certificate
+	ErrInvalidCABundle = errors.New("invalid CA bundle")
+	// ErrMonitorClosed is returned when watching a secret with a closed ExpiryMonitor
+	ErrMonitorClosed = errors.New("expiry monitor is closed")
+	// ErrCallbackPanic is reported when a callback registered with OnChange panicked
+	ErrCallbackPanic = errors.New("secret change callback panicked")
+	// ErrCallbackTimeout is reported when a callback registered with OnChange did not
+	// return within its timeout
+	ErrCallbackTimeout = errors.New("secret change callback timed out")
+)
@@ -0,0 +1,113 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for done channel")
+	}
+}
+
+func TestSecretLoader_ErrAfterClose(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	assert.NoError(t, loader.Err())
+	assert.NoError(t, secret.Err())
+
+	loader.Close()
+
+	waitDone(t, loader.Done())
+	waitDone(t, secret.Done())
+	assert.ErrorIs(t, loader.Err(), secrets.ErrLoaderClosed)
+	assert.NotErrorIs(t, loader.Err(), context.Canceled)
+	assert.ErrorIs(t, secret.Err(), secrets.ErrLoaderClosed)
+
+	_, err = loader.GetSecret("token")
+	assert.ErrorIs(t, err, secrets.ErrLoaderClosed)
+	_, err = secret.ListenChanges()
+	assert.ErrorIs(t, err, secrets.ErrSecretClosed)
+}
+
+func TestSecretLoader_ErrAfterContextCancellation(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loader, err := secrets.NewFileSecretLoader(
+		ctx,
+		secrets.WithBasePath("/mnt/secrets_store"),
+		secrets.WithFileReader(mfs),
+		secrets.WithWatcherFactory(mocks.NewMockWatcherFactory()),
+	)
+	require.NoError(t, err)
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	cancel()
+
+	waitDone(t, loader.Done())
+	waitDone(t, secret.Done())
+	assert.ErrorIs(t, loader.Err(), secrets.ErrLoaderClosed)
+	assert.ErrorIs(t, loader.Err(), context.Canceled)
+	assert.ErrorIs(t, secret.Err(), context.Canceled)
+}
+
+func TestSecretLoader_ErrWhileWatcherFailed(t *testing.T) {
+	loader, _, mwf := newMockLoader(t, secrets.WithWatcherBackoff(time.Hour, time.Hour))
+
+	mwf.FailNext(1)
+	mwf.GetWatcher().SimulateError(errors.New("inotify queue overflow"))
+
+	require.Eventually(t, func() bool {
+		return errors.Is(loader.Err(), secrets.ErrWatcherFailed)
+	}, time.Second, 5*time.Millisecond)
+
+	// A failed watcher is not terminal
+	select {
+	case <-loader.Done():
+		t.Fatal("loader closed because of a watcher failure")
+	default:
+	}
+}
+
+func TestSecret_ErrOnReadFailure(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	reader := &failingReader{FileReader: mfs}
+	loader, _, mwf := newMockLoader(t, secrets.WithFileReader(reader))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	_, err = secret.ListenChanges()
+	require.NoError(t, err)
+
+	reader.fail.Store(true)
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+	require.Eventually(t, func() bool {
+		return errors.Is(secret.Err(), secrets.ErrReadFailed)
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "v1", secret.Value())
+
+	reader.fail.Store(false)
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+	require.Eventually(t, func() bool { return secret.Err() == nil }, time.Second, 5*time.Millisecond)
+}
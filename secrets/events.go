@@ -0,0 +1,97 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// ChangeCause tells why a change of a secret was detected
+type ChangeCause int
+
+const (
+	// CauseRotation is a new value written to an existing secret file
+	CauseRotation ChangeCause = iota
+	// CauseRecreated is a secret file that was created again after it had been deleted
+	CauseRecreated
+	// CauseRecovered is a change that was missed while the file watcher was down and found
+	// once it was rebuilt
+	CauseRecovered
+)
+
+func (c ChangeCause) String() string {
+	switch c {
+	case CauseRotation:
+		return "rotation"
+	case CauseRecreated:
+		return "recreated"
+	case CauseRecovered:
+		return "recovered"
+	default:
+		return fmt.Sprintf("ChangeCause(%d)", int(c))
+	}
+}
+
+// ChangeEvent describes a change of a secret. The new value is only available from the Value
+// method, so an event can be logged as is, whether formatted or encoded as JSON.
+type ChangeEvent struct {
+	Key string
+	// Version is the version of the new value, see Secret.Version
+	Version uint64
+	// DetectedAt is when the change was detected
+	DetectedAt time.Time
+	// ModTime is the modification time of the secret file, zero if it could not be read
+	ModTime time.Time
+	Cause   ChangeCause
+	// OldFingerprint and NewFingerprint are the hex encoded SHA-256 hashes of the values
+	OldFingerprint string
+	NewFingerprint string
+	value          string
+}
+
+// Value returns the new value of the secret
+func (e ChangeEvent) Value() string {
+	return e.value
+}
+
+func (e ChangeEvent) String() string {
+	return fmt.Sprintf("%s v%d %s at %s (%s -> %s)",
+		e.Key, e.Version, e.Cause, e.DetectedAt.Format(time.RFC3339Nano), e.OldFingerprint, e.NewFingerprint)
+}
+
+// GoString keeps %#v from printing the unexported value
+func (e ChangeEvent) GoString() string {
+	return fmt.Sprintf("secrets.ChangeEvent{Key:%q, Version:%d, DetectedAt:%q, ModTime:%q, Cause:%s, "+
+		"OldFingerprint:%q, NewFingerprint:%q}",
+		e.Key, e.Version, e.DetectedAt.Format(time.RFC3339Nano), e.ModTime.Format(time.RFC3339Nano), e.Cause,
+		e.OldFingerprint, e.NewFingerprint)
+}
+
+// Fingerprint returns the hex encoded SHA-256 hash of a secret value, for comparing values
+// without revealing them
+func Fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func newChangeEvent(key string, change valueChange) ChangeEvent {
+	return ChangeEvent{
+		Key:            key,
+		Version:        change.version,
+		DetectedAt:     change.detectedAt,
+		ModTime:        change.modTime,
+		Cause:          change.cause,
+		OldFingerprint: Fingerprint(change.oldValue),
+		NewFingerprint: Fingerprint(change.newValue),
+		value:          change.newValue,
+	}
+}
+
+// ListenEvents subscribes to the change events of the secret. The options decide what
+// happens when the subscriber falls behind, like for Subscribe.
+func (fs *fileSecret) ListenEvents(opts ...SubscribeOption) (*Subscription[ChangeEvent], error) {
+	return subscribe(fs, opts, func(change valueChange) ChangeEvent {
+		return newChangeEvent(fs.id, change)
+	})
+}
@@ -0,0 +1,112 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func receiveChangeEvent(t *testing.T, events <-chan secrets.ChangeEvent) secrets.ChangeEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "event channel closed")
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for change event")
+		return secrets.ChangeEvent{}
+	}
+}
+
+func TestSecret_ListenEvents(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithWatcherBackoff(5*time.Millisecond, 20*time.Millisecond))
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), secret.Version())
+
+	subscription, err := secret.ListenEvents(secrets.DropOldest(10))
+	require.NoError(t, err)
+
+	// rotation
+	before := time.Now()
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+
+	event := receiveChangeEvent(t, subscription.Changes())
+	assert.Equal(t, "token", event.Key)
+	assert.Equal(t, uint64(2), event.Version)
+	assert.Equal(t, secrets.CauseRotation, event.Cause)
+	assert.False(t, event.DetectedAt.Before(before))
+	assert.False(t, event.ModTime.IsZero())
+	assert.Equal(t, secrets.Fingerprint("v1"), event.OldFingerprint)
+	assert.Equal(t, secrets.Fingerprint("v2"), event.NewFingerprint)
+	assert.Equal(t, "v2", event.Value())
+	assert.Equal(t, uint64(2), secret.Version())
+
+	// recreation after deletion
+	mfs.RemoveFile("/mnt/secrets_store/token")
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Remove)
+	require.Eventually(t, func() bool { _, stale := secret.StaleSince(); return stale }, time.Second, time.Millisecond)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v3"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Create)
+
+	event = receiveChangeEvent(t, subscription.Changes())
+	assert.Equal(t, uint64(3), event.Version)
+	assert.Equal(t, secrets.CauseRecreated, event.Cause)
+
+	// recovery after a watcher failure
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v4"))
+	mwf.GetWatcher().SimulateError(errors.New("inotify queue overflow"))
+
+	event = receiveChangeEvent(t, subscription.Changes())
+	assert.Equal(t, uint64(4), event.Version)
+	assert.Equal(t, secrets.CauseRecovered, event.Cause)
+
+	subscription.Unsubscribe()
+	_, open := <-subscription.Changes()
+	assert.False(t, open)
+}
+
+func TestChangeEvent_LoggingDoesNotRevealValue(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/db/password", []byte("hunter1"))
+	secret, err := loader.GetSecret("db/password")
+	require.NoError(t, err)
+	subscription, err := secret.ListenEvents()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/db/password", []byte("hunter2"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/db/password", fsnotify.Write)
+	event := receiveChangeEvent(t, subscription.Changes())
+	require.Equal(t, "hunter2", event.Value())
+
+	for _, format := range []string{"%v", "%+v", "%s", "%#v"} {
+		formatted := fmt.Sprintf(format, event)
+		assert.NotContains(t, formatted, "hunter2", format)
+		assert.Contains(t, formatted, "db/password", format)
+		assert.Contains(t, formatted, "rotation", format)
+		assert.Contains(t, formatted, secrets.Fingerprint("hunter2"), format)
+	}
+
+	encoded, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "hunter2")
+	assert.Contains(t, string(encoded), secrets.Fingerprint("hunter2"))
+
+	var logged bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logged, nil)).Info("secret changed", "event", event)
+	slog.New(slog.NewTextHandler(&logged, nil)).Info("secret changed", "event", event)
+	assert.NotContains(t, logged.String(), "hunter2")
+	assert.Contains(t, logged.String(), "db/password")
+}
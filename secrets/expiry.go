@@ -0,0 +1,397 @@
+package secrets
+
+import (
+	"cmp"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertificateInfo describes the leaf certificate of a PEM secret
+type CertificateInfo struct {
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	DNSNames     []string
+	NotBefore    time.Time
+	NotAfter     time.Time
+}
+
+// ExpiresIn returns how long the certificate is still valid at the given time, negative
+// once it expired
+func (i CertificateInfo) ExpiresIn(now time.Time) time.Duration {
+	return i.NotAfter.Sub(now)
+}
+
+// olderThan tells whether the certificate was issued before the other one. The expiry is
+// not compared, a renewal may well be shorter-lived than the certificate it replaces.
+func (i CertificateInfo) olderThan(other CertificateInfo) bool {
+	return i.NotBefore.Before(other.NotBefore)
+}
+
+func newCertificateInfo(certificate *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Subject:      certificate.Subject.String(),
+		Issuer:       certificate.Issuer.String(),
+		SerialNumber: certificate.SerialNumber.String(),
+		DNSNames:     certificate.DNSNames,
+		NotBefore:    certificate.NotBefore,
+		NotAfter:     certificate.NotAfter,
+	}
+}
+
+// ParseCertificateInfo returns the metadata of the first certificate of a PEM value, which
+// is the leaf of a certificate chain
+func ParseCertificateInfo(value string) (CertificateInfo, error) {
+	certificates, err := parseCertificates([]byte(value))
+	if err != nil {
+		return CertificateInfo{}, err
+	}
+	return newCertificateInfo(certificates[0]), nil
+}
+
+// Info returns the metadata of the current leaf certificate
+func (s *CertificateSource) Info() CertificateInfo {
+	certificate := s.current.Get()
+	if certificate.Leaf != nil {
+		return newCertificateInfo(certificate.Leaf)
+	}
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return CertificateInfo{}
+	}
+	return newCertificateInfo(leaf)
+}
+
+// ExpiryEventKind tells what an ExpiryEvent reports
+type ExpiryEventKind int
+
+const (
+	// ExpiryWarning is a certificate that crossed one of the warning thresholds
+	ExpiryWarning ExpiryEventKind = iota
+	// ExpiryExpired is a certificate that expired
+	ExpiryExpired
+	// ExpiryRegression is a rotated certificate that is older than the one it replaced:
+	// it was issued earlier, e.g. because a stale file was restored
+	ExpiryRegression
+)
+
+func (k ExpiryEventKind) String() string {
+	switch k {
+	case ExpiryWarning:
+		return "warning"
+	case ExpiryExpired:
+		return "expired"
+	case ExpiryRegression:
+		return "regression"
+	default:
+		return fmt.Sprintf("ExpiryEventKind(%d)", int(k))
+	}
+}
+
+// ExpiryEvent reports a certificate that is about to expire, expired, or replaced one that
+// was issued later
+type ExpiryEvent struct {
+	Key  string
+	Kind ExpiryEventKind
+	// Threshold is the warning threshold that was crossed, zero for other kinds
+	Threshold time.Duration
+	// ExpiresIn is how long the certificate was still valid when the event was emitted
+	ExpiresIn   time.Duration
+	Certificate CertificateInfo
+	// Previous is the certificate that was replaced, only set for ExpiryRegression
+	Previous *CertificateInfo
+}
+
+func (e ExpiryEvent) String() string {
+	switch e.Kind {
+	case ExpiryWarning:
+		return fmt.Sprintf("%s: certificate %s expires in %s (threshold %s)",
+			e.Key, e.Certificate.Subject, e.ExpiresIn.Round(time.Second), e.Threshold)
+	case ExpiryRegression:
+		return fmt.Sprintf("%s: certificate %s (issued at %s) replaced a certificate issued later (at %s)",
+			e.Key, e.Certificate.Subject, e.Certificate.NotBefore.Format(time.RFC3339), e.Previous.NotBefore.Format(time.RFC3339))
+	default:
+		return fmt.Sprintf("%s: certificate %s %s at %s",
+			e.Key, e.Certificate.Subject, e.Kind, e.Certificate.NotAfter.Format(time.RFC3339))
+	}
+}
+
+const (
+	defaultExpiryCheckInterval = time.Minute
+	defaultExpiryBufferSize    = 16
+)
+
+// ExpiryOption configures an ExpiryMonitor
+type ExpiryOption func(*ExpiryMonitor)
+
+// WithExpiryThresholds sets how long before expiry warnings are emitted, 30, 7 and 1 days
+// by default. One warning is emitted per threshold and certificate.
+func WithExpiryThresholds(thresholds ...time.Duration) ExpiryOption {
+	return func(m *ExpiryMonitor) {
+		m.thresholds = thresholds
+	}
+}
+
+// WithExpiryCheckInterval sets how often the certificates are checked against the
+// thresholds, every minute by default. Rotations are checked as soon as they are loaded.
+// Intervals of 0 or less keep the default.
+func WithExpiryCheckInterval(interval time.Duration) ExpiryOption {
+	return func(m *ExpiryMonitor) {
+		m.interval = interval
+	}
+}
+
+// WithExpiryBufferSize sets how many events are buffered for a slow reader, 16 by default.
+// Events that do not fit are dropped and counted by Dropped. Negative sizes keep the
+// default.
+func WithExpiryBufferSize(size int) ExpiryOption {
+	return func(m *ExpiryMonitor) {
+		m.bufferSize = size
+	}
+}
+
+// monitoredCertificate is the state of a secret watched by an ExpiryMonitor
+type monitoredCertificate struct {
+	registrations []*Registration
+	info          CertificateInfo
+	// loaded is false until the first certificate was read
+	loaded bool
+	// warned is how many thresholds, from the longest, were already reported
+	warned  int
+	expired bool
+}
+
+// ExpiryMonitor watches the certificates stored as PEM in secrets, and emits an event when
+// one crosses a warning threshold, expires, or is rotated to an older certificate
+type ExpiryMonitor struct {
+	loader     SecretLoader
+	thresholds []time.Duration
+	interval   time.Duration
+	bufferSize int
+	events     chan ExpiryEvent
+	dropped    atomic.Uint64
+	mu         sync.Mutex
+	watched    map[string]*monitoredCertificate
+	closed     bool
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+// NewExpiryMonitor creates a monitor for certificates loaded from the loader. Secrets are
+// added with Watch.
+func NewExpiryMonitor(loader SecretLoader, opts ...ExpiryOption) *ExpiryMonitor {
+	m := &ExpiryMonitor{
+		loader:     loader,
+		thresholds: []time.Duration{30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour},
+		interval:   defaultExpiryCheckInterval,
+		bufferSize: defaultExpiryBufferSize,
+		watched:    make(map[string]*monitoredCertificate),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.interval <= 0 {
+		m.interval = defaultExpiryCheckInterval
+	}
+	if m.bufferSize < 0 {
+		m.bufferSize = defaultExpiryBufferSize
+	}
+	// Longest first, so that warned counts the crossed thresholds
+	m.thresholds = slices.Clone(m.thresholds)
+	slices.SortFunc(m.thresholds, func(a, b time.Duration) int { return cmp.Compare(b, a) })
+	m.events = make(chan ExpiryEvent, m.bufferSize)
+
+	go m.run()
+	return m
+}
+
+// Watch starts monitoring the certificate stored under the given key, the leaf of the
+// chain for a certificate chain. It fails if the secret does not hold a certificate. Events
+// for thresholds that were already crossed are emitted right away.
+func (m *ExpiryMonitor) Watch(secretKey string) error {
+	secret, err := m.loader.GetSecret(secretKey)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrMonitorClosed
+	}
+	if _, ok := m.watched[secretKey]; ok {
+		m.mu.Unlock()
+		return nil
+	}
+	watched := &monitoredCertificate{}
+	m.watched[secretKey] = watched
+	m.mu.Unlock()
+
+	registrations, err := reloadOnChange([]Secret{secret}, func() error {
+		return m.load(secretKey, secret.Value())
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		delete(m.watched, secretKey)
+		return err
+	}
+	if m.closed {
+		// Close did not see the registrations yet
+		for _, registration := range registrations {
+			registration.Remove()
+		}
+		return ErrMonitorClosed
+	}
+	watched.registrations = registrations
+	return nil
+}
+
+// Certificate returns the metadata of the certificate monitored under the given key
+func (m *ExpiryMonitor) Certificate(secretKey string) (CertificateInfo, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	watched, ok := m.watched[secretKey]
+	if !ok || !watched.loaded {
+		return CertificateInfo{}, false
+	}
+	return watched.info, true
+}
+
+// Events returns the channel on which events are delivered. It is closed by Close.
+func (m *ExpiryMonitor) Events() <-chan ExpiryEvent {
+	return m.events
+}
+
+// Dropped returns how many events were dropped because the buffer was full
+func (m *ExpiryMonitor) Dropped() uint64 {
+	return m.dropped.Load()
+}
+
+// load checks the current certificate of a secret. After the first one, values that are not
+// a certificate are ignored and the previous certificate is still monitored.
+func (m *ExpiryMonitor) load(secretKey, value string) error {
+	info, err := ParseCertificateInfo(value)
+	if err != nil {
+		return fmt.Errorf("%w %s: %w", ErrDecodeFailed, secretKey, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	watched, ok := m.watched[secretKey]
+	if !ok || m.closed {
+		return nil
+	}
+
+	now := time.Now()
+	if watched.loaded {
+		previous := watched.info
+		if previous.SerialNumber == info.SerialNumber && previous.Issuer == info.Issuer {
+			return nil
+		}
+		if info.olderThan(previous) {
+			m.emitLocked(ExpiryEvent{
+				Key:         secretKey,
+				Kind:        ExpiryRegression,
+				ExpiresIn:   info.ExpiresIn(now),
+				Certificate: info,
+				Previous:    &previous,
+			})
+		}
+	}
+	*watched = monitoredCertificate{registrations: watched.registrations, info: info, loaded: true}
+	m.checkLocked(secretKey, watched, now)
+	return nil
+}
+
+func (m *ExpiryMonitor) run() {
+	defer close(m.stopped)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for key, watched := range m.watched {
+				if watched.loaded {
+					m.checkLocked(key, watched, now)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// checkLocked emits the events of the thresholds the certificate crossed since the last check
+func (m *ExpiryMonitor) checkLocked(secretKey string, watched *monitoredCertificate, now time.Time) {
+	expiresIn := watched.info.ExpiresIn(now)
+	if expiresIn <= 0 {
+		if !watched.expired {
+			watched.expired = true
+			watched.warned = len(m.thresholds)
+			m.emitLocked(ExpiryEvent{Key: secretKey, Kind: ExpiryExpired, ExpiresIn: expiresIn, Certificate: watched.info})
+		}
+		return
+	}
+
+	crossed := watched.warned
+	for crossed < len(m.thresholds) && expiresIn <= m.thresholds[crossed] {
+		crossed++
+	}
+	if crossed == watched.warned {
+		return
+	}
+	// Only the shortest crossed threshold is reported, there is no point in a 30 days
+	// warning for a certificate expiring tomorrow
+	watched.warned = crossed
+	m.emitLocked(ExpiryEvent{
+		Key:         secretKey,
+		Kind:        ExpiryWarning,
+		Threshold:   m.thresholds[crossed-1],
+		ExpiresIn:   expiresIn,
+		Certificate: watched.info,
+	})
+}
+
+func (m *ExpiryMonitor) emitLocked(event ExpiryEvent) {
+	select {
+	case m.events <- event:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+// Close stops monitoring and closes the events channel
+func (m *ExpiryMonitor) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.done)
+	watched := maps.Clone(m.watched)
+	m.mu.Unlock()
+
+	for _, w := range watched {
+		for _, registration := range w.registrations {
+			registration.Remove()
+		}
+	}
+	<-m.stopped
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	close(m.events)
+}
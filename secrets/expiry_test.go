@@ -0,0 +1,181 @@
+package secrets_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func receiveExpiryEvent(t *testing.T, m *secrets.ExpiryMonitor) secrets.ExpiryEvent {
+	t.Helper()
+	select {
+	case event := <-m.Events():
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for expiry event")
+		return secrets.ExpiryEvent{}
+	}
+}
+
+func TestExpiryMonitor_WarnsOncePerThreshold(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	soon := newTestCert(t, certTemplate("soon.example.com", time.Now().Add(time.Hour)), nil)
+	later := newTestCert(t, certTemplate("later.example.com", time.Now().Add(90*24*time.Hour)), nil)
+	mfs.WriteFile("/mnt/secrets_store/soon.crt", []byte(soon.certPEM))
+	mfs.WriteFile("/mnt/secrets_store/later.crt", []byte(later.certPEM+soon.certPEM))
+
+	// The second threshold is crossed shortly after the monitor started
+	crossing := time.Until(soon.cert.NotAfter) - 200*time.Millisecond
+	monitor := secrets.NewExpiryMonitor(loader,
+		secrets.WithExpiryThresholds(24*time.Hour, crossing, 2*time.Hour),
+		secrets.WithExpiryCheckInterval(10*time.Millisecond))
+	defer monitor.Close()
+
+	require.NoError(t, monitor.Watch("soon.crt"))
+	require.NoError(t, monitor.Watch("later.crt"))
+
+	// Only the shortest threshold crossed so far is reported
+	event := receiveExpiryEvent(t, monitor)
+	assert.Equal(t, "soon.crt", event.Key)
+	assert.Equal(t, secrets.ExpiryWarning, event.Kind)
+	assert.Equal(t, 2*time.Hour, event.Threshold)
+	assert.Equal(t, "CN=soon.example.com", event.Certificate.Subject)
+	assert.Equal(t, soon.cert.NotAfter, event.Certificate.NotAfter)
+
+	event = receiveExpiryEvent(t, monitor)
+	assert.Equal(t, secrets.ExpiryWarning, event.Kind)
+	assert.Equal(t, crossing, event.Threshold)
+	assert.LessOrEqual(t, event.ExpiresIn, crossing)
+
+	select {
+	case event := <-monitor.Events():
+		t.Fatalf("unexpected event %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The leaf of a chain is monitored
+	info, ok := monitor.Certificate("later.crt")
+	require.True(t, ok)
+	assert.Equal(t, []string{"later.example.com"}, info.DNSNames)
+	assert.Equal(t, later.cert.SerialNumber.String(), info.SerialNumber)
+}
+
+func TestExpiryMonitor_FlagsOlderRotationsAndExpiry(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	template := certTemplate("api.example.com", time.Now().Add(60*24*time.Hour))
+	template.NotBefore = time.Now().Add(-24 * time.Hour)
+	current := newTestCert(t, template, nil)
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(current.certPEM))
+
+	monitor := secrets.NewExpiryMonitor(loader)
+	defer monitor.Close()
+	require.NoError(t, monitor.Watch("tls.crt"))
+
+	rotate := func(c *testCert) {
+		mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(c.certPEM))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/tls.crt", fsnotify.Write)
+	}
+
+	// A renewed certificate is not reported
+	renewed := newTestCert(t, certTemplate("api.example.com", time.Now().Add(90*24*time.Hour)), nil)
+	rotate(renewed)
+	require.Eventually(t, func() bool {
+		info, _ := monitor.Certificate("tls.crt")
+		return info.NotAfter.Equal(renewed.cert.NotAfter)
+	}, time.Second, time.Millisecond)
+
+	// Restoring the previous certificate is a regression, and its thresholds apply
+	rotate(current)
+	event := receiveExpiryEvent(t, monitor)
+	assert.Equal(t, secrets.ExpiryRegression, event.Kind)
+	assert.Equal(t, current.cert.NotAfter, event.Certificate.NotAfter)
+	require.NotNil(t, event.Previous)
+	assert.Equal(t, renewed.cert.NotAfter, event.Previous.NotAfter)
+	assert.Equal(t, fmt.Sprintf("tls.crt: certificate CN=api.example.com (issued at %s) replaced a certificate issued later (at %s)",
+		current.cert.NotBefore.Format(time.RFC3339), renewed.cert.NotBefore.Format(time.RFC3339)), event.String())
+
+	template = certTemplate("api.example.com", time.Now().Add(-time.Minute))
+	template.NotBefore = time.Now().Add(-48 * time.Hour)
+	expired := newTestCert(t, template, nil)
+	rotate(expired)
+	assert.Equal(t, secrets.ExpiryRegression, receiveExpiryEvent(t, monitor).Kind)
+	event = receiveExpiryEvent(t, monitor)
+	assert.Equal(t, secrets.ExpiryExpired, event.Kind)
+	assert.Negative(t, event.ExpiresIn)
+
+	// Values that are not a certificate are ignored
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte("not a certificate"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/tls.crt", fsnotify.Write)
+	time.Sleep(20 * time.Millisecond)
+	info, _ := monitor.Certificate("tls.crt")
+	assert.Equal(t, expired.cert.NotAfter, info.NotAfter)
+
+	monitor.Close()
+	_, open := <-monitor.Events()
+	assert.False(t, open)
+	assert.ErrorIs(t, monitor.Watch("tls.crt"), secrets.ErrMonitorClosed)
+}
+
+func TestExpiryMonitor_AcceptsShorterLivedRenewals(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	template := certTemplate("api.example.com", time.Now().Add(365*24*time.Hour))
+	template.NotBefore = time.Now().Add(-24 * time.Hour)
+	current := newTestCert(t, template, nil)
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(current.certPEM))
+
+	monitor := secrets.NewExpiryMonitor(loader)
+	defer monitor.Close()
+	require.NoError(t, monitor.Watch("tls.crt"))
+
+	// Issued later, but for a shorter lifetime than the certificate it replaces
+	renewed := newTestCert(t, certTemplate("api.example.com", time.Now().Add(90*24*time.Hour)), nil)
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(renewed.certPEM))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/tls.crt", fsnotify.Write)
+	require.Eventually(t, func() bool {
+		info, _ := monitor.Certificate("tls.crt")
+		return info.NotAfter.Equal(renewed.cert.NotAfter)
+	}, time.Second, time.Millisecond)
+
+	select {
+	case event := <-monitor.Events():
+		t.Fatalf("unexpected event: %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestExpiryMonitor_InvalidOptionsKeepDefaults(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	template := certTemplate("api.example.com", time.Now().Add(-time.Minute))
+	template.NotBefore = time.Now().Add(-48 * time.Hour)
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(newTestCert(t, template, nil).certPEM))
+
+	monitor := secrets.NewExpiryMonitor(loader,
+		secrets.WithExpiryCheckInterval(0),
+		secrets.WithExpiryBufferSize(-1),
+	)
+	defer monitor.Close()
+	require.NoError(t, monitor.Watch("tls.crt"))
+
+	// The event is buffered although nobody was reading yet
+	assert.Equal(t, secrets.ExpiryExpired, receiveExpiryEvent(t, monitor).Kind)
+	assert.Zero(t, monitor.Dropped())
+}
+
+func TestExpiryMonitor_RejectsNonCertificates(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/password", []byte("hunter2"))
+
+	monitor := secrets.NewExpiryMonitor(loader)
+	defer monitor.Close()
+
+	assert.ErrorIs(t, monitor.Watch("password"), secrets.ErrDecodeFailed)
+	assert.ErrorIs(t, monitor.Watch("missing.crt"), secrets.ErrSecretNotFound)
+	_, ok := monitor.Certificate("password")
+	assert.False(t, ok)
+}
@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a structured secret file
+type Format int
+
+const (
+	// FormatAuto selects the format by the extension of the secret file: .json, .yaml,
+	// .yml or .toml
+	FormatAuto Format = iota
+	FormatJSON
+	FormatYAML
+	FormatTOML
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatAuto:
+		return "auto"
+	case FormatJSON:
+		return "JSON"
+	case FormatYAML:
+		return "YAML"
+	case FormatTOML:
+		return "TOML"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// FormatForKey selects the format of a secret by the extension of its key
+func FormatForKey(secretKey string) (Format, error) {
+	switch strings.ToLower(path.Ext(secretKey)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return FormatAuto, fmt.Errorf("cannot tell the format of secret %s from its extension", secretKey)
+	}
+}
+
+// resolve returns the format to use for the secret, looking at its extension for FormatAuto
+func (f Format) resolve(secretKey string) (Format, error) {
+	switch f {
+	case FormatAuto:
+		return FormatForKey(secretKey)
+	case FormatJSON, FormatYAML, FormatTOML:
+		return f, nil
+	default:
+		return f, fmt.Errorf("unknown secret format %s", f)
+	}
+}
+
+// unmarshaler returns the function decoding documents of the format
+func (f Format) unmarshaler() (unmarshalFunc, error) {
+	switch f {
+	case FormatJSON:
+		return unmarshalJSON, nil
+	case FormatYAML:
+		return yaml.Unmarshal, nil
+	case FormatTOML:
+		return toml.Unmarshal, nil
+	default:
+		return nil, fmt.Errorf("unknown secret format %s", f)
+	}
+}
+
+// FormatDecoder returns a decoder for secrets of the given format, which must not be
+// FormatAuto; use FormatForKey to select the format by extension
+func FormatDecoder[T any](format Format) (Decoder[T], error) {
+	unmarshal, err := format.unmarshaler()
+	if err != nil {
+		return nil, err
+	}
+	return DecoderFunc[T](func(value string) (T, error) {
+		var decoded T
+		err := unmarshal([]byte(value), &decoded)
+		return decoded, err
+	}), nil
+}
+
+// YAMLDecoder decodes secrets holding a YAML document
+func YAMLDecoder[T any]() Decoder[T] {
+	decoder, _ := FormatDecoder[T](FormatYAML)
+	return decoder
+}
+
+// TOMLDecoder decodes secrets holding a TOML document
+func TOMLDecoder[T any]() Decoder[T] {
+	decoder, _ := FormatDecoder[T](FormatTOML)
+	return decoder
+}
+
+// ValidFormat returns a validator rejecting values that are not valid documents of the
+// format, which must not be FormatAuto
+func ValidFormat(format Format) Validator {
+	return func(value string) error {
+		unmarshal, err := format.unmarshaler()
+		if err != nil {
+			return err
+		}
+		var document any
+		if err := unmarshal([]byte(value), &document); err != nil {
+			return fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package secrets_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+type dbConfig struct {
+	Username string `json:"username" yaml:"username" toml:"username"`
+	Password string `json:"password" yaml:"password" toml:"password"`
+	Port     int    `json:"port" yaml:"port" toml:"port"`
+}
+
+var formatDocuments = []struct {
+	key     string
+	format  secrets.Format
+	content string
+	broken  string
+}{
+	{
+		key:     "db.json",
+		format:  secrets.FormatJSON,
+		content: `{"username": "app", "password": "p1", "port": 5432}`,
+		broken:  `{"username": "app", "pass`,
+	},
+	{
+		key:     "db.yaml",
+		format:  secrets.FormatYAML,
+		content: "username: app\npassword: p1\nport: 5432\n",
+		broken:  "username: app\npassword: [p1\n",
+	},
+	{
+		key:     "db.toml",
+		format:  secrets.FormatTOML,
+		content: "username = \"app\"\npassword = \"p1\"\nport = 5432\n",
+		broken:  "username = \"app\"\npassword = \"p1\n",
+	},
+}
+
+func TestFormatForKey(t *testing.T) {
+	for key, expected := range map[string]secrets.Format{
+		"db.json":      secrets.FormatJSON,
+		"helm/db.yaml": secrets.FormatYAML,
+		"db.YML":       secrets.FormatYAML,
+		"legacy.toml":  secrets.FormatTOML,
+	} {
+		format, err := secrets.FormatForKey(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, expected, format, key)
+	}
+
+	_, err := secrets.FormatForKey("password")
+	assert.Error(t, err)
+}
+
+func TestDocument_Formats(t *testing.T) {
+	for _, tt := range formatDocuments {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			loader, mfs, mwf := newMockLoader(t)
+			mfs.WriteFile("/mnt/secrets_store/"+tt.key, []byte(tt.content))
+
+			// Selected by extension
+			doc, err := loader.GetDocument(tt.key, secrets.FormatAuto)
+			require.NoError(t, err)
+			assert.Equal(t, tt.format, doc.Format())
+
+			var config dbConfig
+			require.NoError(t, doc.Decode(&config))
+			assert.Equal(t, dbConfig{Username: "app", Password: "p1", Port: 5432}, config)
+
+			password, err := doc.Field("/password")
+			require.NoError(t, err)
+			assert.Equal(t, "p1", password.Value())
+			port, err := doc.Field("/port")
+			require.NoError(t, err)
+			assert.Equal(t, "5432", port.Value())
+
+			// A value that cannot be decoded is not published
+			mfs.WriteFile("/mnt/secrets_store/"+tt.key, []byte(tt.broken))
+			mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/"+tt.key, fsnotify.Write)
+			require.Eventually(t, func() bool { return doc.Secret().Err() != nil }, time.Second, time.Millisecond)
+			assert.ErrorIs(t, doc.Secret().Err(), secrets.ErrValidationFailed)
+			assert.ErrorIs(t, doc.Secret().Err(), secrets.ErrDecodeFailed)
+			assert.Equal(t, tt.content, doc.Secret().Value())
+			assert.Equal(t, "p1", password.Value())
+		})
+	}
+}
+
+func TestDocument_ExplicitFormat(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/values", []byte("password: p1\n"))
+
+	_, err := loader.GetDocument("values", secrets.FormatAuto)
+	assert.Error(t, err, "no extension to select the format by")
+
+	doc, err := loader.GetDocument("values", secrets.FormatYAML)
+	require.NoError(t, err)
+	values, err := doc.Map()
+	require.NoError(t, err)
+	assert.Equal(t, "p1", values["password"])
+
+	mfs.WriteFile("/mnt/secrets_store/trailing.json", []byte(`{"password": "p1"} trailing`))
+	_, err = loader.GetJSONDocument("trailing.json")
+	assert.ErrorIs(t, err, secrets.ErrDecodeFailed)
+}
+
+func TestFormatDecoders(t *testing.T) {
+	for _, tt := range formatDocuments {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			loader, mfs, _ := newMockLoader(t)
+			mfs.WriteFile("/mnt/secrets_store/"+tt.key, []byte(tt.content))
+			secret, err := loader.GetSecret(tt.key, secrets.WithSecretValidator(secrets.ValidFormat(tt.format)))
+			require.NoError(t, err)
+
+			decoder, err := secrets.FormatDecoder[dbConfig](tt.format)
+			require.NoError(t, err)
+			config, err := secrets.NewTyped(secret, decoder).Value()
+			require.NoError(t, err)
+			assert.Equal(t, "p1", config.Password)
+
+			assert.Error(t, secrets.ValidFormat(tt.format)(tt.broken))
+		})
+	}
+
+	yamlConfig, err := secrets.YAMLDecoder[dbConfig]().Decode("password: p2\n")
+	require.NoError(t, err)
+	assert.Equal(t, "p2", yamlConfig.Password)
+	tomlConfig, err := secrets.TOMLDecoder[dbConfig]().Decode("password = \"p3\"\n")
+	require.NoError(t, err)
+	assert.Equal(t, "p3", tomlConfig.Password)
+
+	_, err = secrets.FormatDecoder[dbConfig](secrets.FormatAuto)
+	assert.Error(t, err)
+}
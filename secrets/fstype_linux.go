@@ -0,0 +1,28 @@
+//go:build linux
+
+package secrets
+
+import "syscall"
+
+// Magic numbers from statfs(2) of file systems on which inotify does not report changes,
+// either because they happen on another host or in a user space daemon
+var noInotifyFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+	0x794c7630: "overlay",
+}
+
+// deliversFileEvents reports whether inotify can be trusted for the given path
+func deliversFileEvents(path string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		// Let fsnotify decide
+		return true
+	}
+	_, noEvents := noInotifyFilesystems[uint32(stat.Type)]
+	return !noEvents
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package secrets
+
+// deliversFileEvents reports whether native file events can be trusted for the given path.
+// File system detection is only implemented on Linux.
+func deliversFileEvents(path string) bool {
+	return true
+}
@@ -0,0 +1,153 @@
+package secrets_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func TestSecretLoader_ListSecretKeysNested(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("a"))
+	mfs.WriteFile("/mnt/secrets_store/db/primary/password", []byte("b"))
+	mfs.WriteFile("/mnt/secrets_store/db/primary/username", []byte("c"))
+	mfs.WriteFile("/mnt/secrets_store/db/replica/password", []byte("d"))
+	mfs.WriteFile("/mnt/secrets_store/dbx/token", []byte("e"))
+	mfs.WriteFile("/mnt/secrets_store/tls/ingress/tls.crt", []byte("f"))
+	mfs.WriteFile("/mnt/secrets_store/tls/.hidden/tls.key", []byte("g"))
+	mfs.WriteFile("/mnt/secrets_store/..data/api-key", []byte("h"))
+
+	tests := []struct {
+		name     string
+		prefix   string
+		expected []string
+	}{
+		{
+			name:   "no prefix lists everything recursively",
+			prefix: "",
+			expected: []string{
+				"api-key",
+				"db/primary/password",
+				"db/primary/username",
+				"db/replica/password",
+				"dbx/token",
+				"tls/ingress/tls.crt",
+			},
+		},
+		{
+			name:     "directory prefix",
+			prefix:   "db/",
+			expected: []string{"db/primary/password", "db/primary/username", "db/replica/password"},
+		},
+		{
+			name:     "partial name prefix",
+			prefix:   "db/pri",
+			expected: []string{"db/primary/password", "db/primary/username"},
+		},
+		{
+			name:     "prefix without slash matches sibling directories",
+			prefix:   "db",
+			expected: []string{"db/primary/password", "db/primary/username", "db/replica/password", "dbx/token"},
+		},
+		{
+			name:     "unknown directory",
+			prefix:   "vault/",
+			expected: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := loader.ListSecretKeysWithPrefix(tt.prefix)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, keys)
+		})
+	}
+
+	_, err := loader.ListSecretKeysWithPrefix("../etc/")
+	assert.Error(t, err)
+}
+
+func TestSecretLoader_GetNestedSecret(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/db/primary/password", []byte("initial"))
+	mfs.WriteFile("/mnt/secrets_store/password", []byte("top-level"))
+
+	secret, err := loader.GetSecret("db/primary/password")
+	require.NoError(t, err)
+	assert.Equal(t, "initial", secret.Value())
+
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/db/primary/password", []byte("rotated"))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/db/primary/password")
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "rotated", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+
+	topLevel, err := loader.GetSecret("password")
+	require.NoError(t, err)
+	assert.Equal(t, "top-level", topLevel.Value())
+}
+
+func TestSecretLoader_WatchesNewSubdirectories(t *testing.T) {
+	_, mfs, mwf := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/tls/ingress/tls.crt", []byte("cert"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/tls", fsnotify.Create)
+
+	require.Eventually(t, func() bool {
+		return mwf.GetWatcher().IsWatched("/mnt/secrets_store/tls/ingress")
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/tls"))
+}
+
+func TestSecretLoader_NestedSecretRealFilesystem(t *testing.T) {
+	dir := t.TempDir()
+
+	loader, err := secrets.NewFileSecretLoader(context.Background(), secrets.WithBasePath(dir))
+	require.NoError(t, err)
+	defer loader.Close()
+
+	// The subdirectory is created after the loader started watching
+	nested := filepath.Join(dir, "db", "primary")
+	require.NoError(t, os.MkdirAll(nested, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "password"), []byte("v1"), 0o644))
+
+	var secret secrets.Secret
+	require.Eventually(t, func() bool {
+		secret, err = loader.GetSecret("db/primary/password")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(nested, "password"), []byte("v2"), 0o644))
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v2", value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+
+	keys, err := loader.ListSecretKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db/primary/password"}, keys)
+}
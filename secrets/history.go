@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"sync"
+	"time"
+)
+
+// WithHistory keeps up to depth previous values of every secret. With a grace period,
+// previous values are dropped once they were replaced for longer than grace.
+func WithHistory(depth int, grace time.Duration) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.secretConfig.historyDepth = depth
+		fsl.secretConfig.historyGrace = grace
+	}
+}
+
+// WithSecretHistory is like WithHistory, for a single secret
+func WithSecretHistory(depth int, grace time.Duration) SecretOption {
+	return func(c *secretConfig) {
+		c.historyDepth = depth
+		c.historyGrace = grace
+	}
+}
+
+// SecretVersion is a value a secret had at some point
+type SecretVersion struct {
+	Value   string
+	Version uint64
+	// LoadedAt is when the value was loaded
+	LoadedAt time.Time
+	// ReplacedAt is when the value was replaced by the next one, zero for the current value
+	ReplacedAt time.Time
+}
+
+// versionHistory holds the current and the previous values of a secret
+type versionHistory struct {
+	mu       sync.Mutex
+	depth    int
+	grace    time.Duration
+	current  SecretVersion
+	previous []SecretVersion // newest first
+}
+
+func newVersionHistory(value string, config secretConfig) *versionHistory {
+	h := &versionHistory{current: SecretVersion{Value: value, Version: 1, LoadedAt: time.Now()}}
+	h.configure(config)
+	return h
+}
+
+// configure changes the depth and grace period, trimming the history if needed
+func (h *versionHistory) configure(config secretConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.depth = max(config.historyDepth, 0)
+	h.grace = config.historyGrace
+	h.trimLocked(time.Now())
+}
+
+// record makes value the current version and moves the previous one into the history
+func (h *versionHistory) record(value string, version uint64, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	replaced := h.current
+	replaced.ReplacedAt = at
+	h.previous = append([]SecretVersion{replaced}, h.previous...)
+	h.current = SecretVersion{Value: value, Version: version, LoadedAt: at}
+	h.trimLocked(at)
+}
+
+func (h *versionHistory) latest() SecretVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.current
+}
+
+// versions returns the current version followed by the previous ones that did not expire
+func (h *versionHistory) versions() []SecretVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trimLocked(time.Now())
+	return append([]SecretVersion{h.current}, h.previous...)
+}
+
+func (h *versionHistory) trimLocked(now time.Time) {
+	if len(h.previous) > h.depth {
+		h.previous = h.previous[:h.depth]
+	}
+	if h.grace <= 0 {
+		return
+	}
+	for i, version := range h.previous {
+		// Older versions were replaced even earlier, so they expired as well
+		if now.Sub(version.ReplacedAt) > h.grace {
+			h.previous = h.previous[:i]
+			return
+		}
+	}
+}
+
+// Current returns the current value of the secret together with its version
+func (fs *fileSecret) Current() SecretVersion {
+	return fs.history.latest()
+}
+
+// Previous returns the value the secret had before the current one, as long as it is kept
+// in the history
+func (fs *fileSecret) Previous() (SecretVersion, bool) {
+	versions := fs.history.versions()
+	if len(versions) < 2 {
+		return SecretVersion{}, false
+	}
+	return versions[1], true
+}
+
+// History returns the current version of the secret followed by the previous versions
+// that are kept, newest first
+func (fs *fileSecret) History() []SecretVersion {
+	return fs.history.versions()
+}
@@ -0,0 +1,111 @@
+package secrets_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func historyValues(versions []secrets.SecretVersion) []string {
+	values := make([]string, 0, len(versions))
+	for _, version := range versions {
+		values = append(values, version.Value)
+	}
+	return values
+}
+
+func TestSecret_History(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithHistory(2, 0))
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	_, ok := secret.Previous()
+	assert.False(t, ok, "no previous value before the first rotation")
+	assert.Equal(t, []string{"v0"}, historyValues(secret.History()))
+
+	rotate(t, secret, func(value string) {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	}, 3)
+
+	history := secret.History()
+	assert.Equal(t, []string{"v3", "v2", "v1"}, historyValues(history), "depth limits the previous values")
+	assert.Equal(t, uint64(4), history[0].Version)
+	assert.True(t, history[0].ReplacedAt.IsZero())
+	assert.Equal(t, uint64(3), history[1].Version)
+	assert.Equal(t, history[0].LoadedAt, history[1].ReplacedAt)
+	assert.False(t, history[1].LoadedAt.After(history[1].ReplacedAt))
+
+	previous, ok := secret.Previous()
+	require.True(t, ok)
+	assert.Equal(t, "v2", previous.Value)
+	assert.Equal(t, uint64(3), previous.Version)
+}
+
+func TestSecret_HistoryGracePeriod(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	mfs.WriteFile("/mnt/secrets_store/other", []byte("o0"))
+
+	secret, err := loader.GetSecret("token", secrets.WithSecretHistory(5, 50*time.Millisecond))
+	require.NoError(t, err)
+	other, err := loader.GetSecret("other")
+	require.NoError(t, err)
+
+	write := func(key, value string) {
+		mfs.WriteFile("/mnt/secrets_store/"+key, []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/"+key, fsnotify.Write)
+	}
+	write("token", "v1")
+	write("other", "o1")
+	require.Eventually(t, func() bool {
+		return secret.Value() == "v1" && other.Value() == "o1"
+	}, time.Second, time.Millisecond)
+
+	previous, ok := secret.Previous()
+	require.True(t, ok)
+	assert.Equal(t, "v0", previous.Value)
+	_, ok = other.Previous()
+	assert.False(t, ok, "secrets without history keep no previous value")
+
+	// The previous value is dropped once the grace period is over
+	require.Eventually(t, func() bool {
+		_, ok := secret.Previous()
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"v1"}, historyValues(secret.History()))
+
+	// Options passed for an already loaded secret reconfigure it
+	same, err := loader.GetSecret("other", secrets.WithSecretHistory(1, 0))
+	require.NoError(t, err)
+	write("other", "o2")
+	require.Eventually(t, func() bool { return same.Value() == "o2" }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"o2", "o1"}, historyValues(same.History()))
+}
+
+func TestSecret_HistoryKeptByLaterOptions(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token", secrets.WithSecretHistory(2, 0))
+	require.NoError(t, err)
+
+	rotate(t, secret, func(value string) {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	}, 2)
+
+	// Options about something else leave the history of the secret alone
+	_, err = loader.GetSecret("token", secrets.WithSecretMaxSize(1<<20))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v2", "v1", "v0"}, historyValues(secret.History()))
+
+	_, err = loader.GetSecret("token", secrets.WithSecretHistory(1, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v2", "v1"}, historyValues(secret.History()))
+}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"io"
 	"io/fs"
 	"os"
 
@@ -35,6 +36,10 @@ func (r *osReadFile) ReadFile(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
+func (r *osReadFile) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
 func (r *osReadFile) Stat(name string) (fs.FileInfo, error) {
 	return os.Stat(name)
 }
@@ -0,0 +1,183 @@
+package secrets_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+// atomicWriterDir reproduces the layout written by the Kubernetes atomic writer:
+// <dir>/<key> -> ..data/<key>, ..data -> ..<generation>
+type atomicWriterDir struct {
+	t          *testing.T
+	dir        string
+	generation int
+	current    string
+}
+
+func newAtomicWriterDir(t *testing.T, files map[string]string) *atomicWriterDir {
+	return newAtomicWriterDirAt(t, t.TempDir(), files)
+}
+
+// newAtomicWriterDirAt writes the layout into dir, which is created if needed
+func newAtomicWriterDirAt(t *testing.T, dir string, files map[string]string) *atomicWriterDir {
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	aw := &atomicWriterDir{t: t, dir: dir}
+	aw.update(files)
+	for key := range files {
+		require.NoError(t, os.Symlink(filepath.Join("..data", key), filepath.Join(aw.dir, key)))
+	}
+	return aw
+}
+
+// update publishes a new generation of files by swapping the ..data symlink
+func (aw *atomicWriterDir) update(files map[string]string) {
+	aw.generation++
+	generation := filepath.Join(aw.dir, fmt.Sprintf("..2025_01_01_00_00_%02d.%d", aw.generation, aw.generation))
+	require.NoError(aw.t, os.Mkdir(generation, 0o755))
+	for key, value := range files {
+		require.NoError(aw.t, os.WriteFile(filepath.Join(generation, key), []byte(value), 0o644))
+	}
+
+	tmpLink := filepath.Join(aw.dir, "..data_tmp")
+	require.NoError(aw.t, os.Symlink(filepath.Base(generation), tmpLink))
+	require.NoError(aw.t, os.Rename(tmpLink, filepath.Join(aw.dir, "..data")))
+
+	if aw.current != "" {
+		require.NoError(aw.t, os.RemoveAll(aw.current))
+	}
+	aw.current = generation
+}
+
+func TestSecretLoader_AtomicWriterRotation(t *testing.T) {
+	aw := newAtomicWriterDir(t, map[string]string{"api-key": "v1", "db-password": "p1"})
+
+	loader, err := secrets.NewFileSecretLoader(context.Background(), secrets.WithBasePath(aw.dir))
+	require.NoError(t, err)
+	defer loader.Close()
+
+	apiKey, err := loader.GetSecret("api-key")
+	require.NoError(t, err)
+	dbPassword, err := loader.GetSecret("db-password")
+	require.NoError(t, err)
+
+	apiChanges, err := apiKey.ListenChanges()
+	require.NoError(t, err)
+	dbChanges, err := dbPassword.ListenChanges()
+	require.NoError(t, err)
+
+	// Repeated rotations swap the inode behind the watched path every time
+	for _, version := range []string{"v2", "v3", "v4"} {
+		aw.update(map[string]string{"api-key": version, "db-password": "p1"})
+
+		select {
+		case value := <-apiChanges:
+			assert.Equal(t, version, value)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for rotation to %s", version)
+		}
+		assert.Equal(t, version, apiKey.Value())
+	}
+
+	// Each change is published exactly once and unchanged keys are not published at all
+	select {
+	case value := <-apiChanges:
+		t.Fatalf("unexpected duplicate notification: %s", value)
+	case value := <-dbChanges:
+		t.Fatalf("unexpected notification for unchanged key: %s", value)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSecretLoader_AtomicWriterRotationInNestedVolume(t *testing.T) {
+	base := t.TempDir()
+	files := func(version string) map[string]string {
+		return map[string]string{
+			"tls.crt":     "crt-" + version,
+			"tls.key":     "key-" + version,
+			"config.json": `{"password":"` + version + `"}`,
+		}
+	}
+	// A secret volume mounted below the base path, next to plain files
+	aw := newAtomicWriterDirAt(t, filepath.Join(base, "tls"), files("v1"))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "other"), []byte("other"), 0o644))
+
+	loader, err := secrets.NewFileSecretLoader(context.Background(), secrets.WithBasePath(base))
+	require.NoError(t, err)
+	defer loader.Close()
+
+	crt, err := loader.GetSecret("tls/tls.crt")
+	require.NoError(t, err)
+	key, err := loader.GetSecret("tls/tls.key")
+	require.NoError(t, err)
+	doc, err := loader.GetJSONDocument("tls/config.json")
+	require.NoError(t, err)
+	password, err := doc.Field("/password")
+	require.NoError(t, err)
+
+	crtChanges, err := crt.ListenChanges()
+	require.NoError(t, err)
+
+	for _, version := range []string{"v2", "v3"} {
+		aw.update(files(version))
+
+		select {
+		case value := <-crtChanges:
+			assert.Equal(t, "crt-"+version, value)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for rotation to %s", version)
+		}
+
+		// Secrets without listeners and parts of files are re-read as well
+		require.Eventually(t, func() bool {
+			return key.Value() == "key-"+version && password.Value() == version
+		}, 2*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestSecretLoader_AtomicSwapRewatchesSecrets(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+
+	mwf := mocks.NewMockWatcherFactory()
+
+	loader, err := secrets.NewFileSecretLoader(
+		context.Background(),
+		secrets.WithBasePath("/mnt/secrets_store"),
+		secrets.WithFileReader(mfs),
+		secrets.WithWatcherFactory(mwf),
+	)
+	require.NoError(t, err)
+	defer loader.Close()
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("old"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	// The watcher drops the watch once the old inode is removed
+	require.NoError(t, mwf.GetWatcher().Remove("/mnt/secrets_store/token"))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("new"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/..data", fsnotify.Create)
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "new", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"))
+}
@@ -0,0 +1,212 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func receiveStatus(t *testing.T, ch <-chan secrets.SecretStatus) secrets.SecretStatus {
+	t.Helper()
+	select {
+	case status, ok := <-ch:
+		require.True(t, ok, "status channel closed unexpectedly")
+		return status
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for status notification")
+	}
+	return secrets.SecretStatus{}
+}
+
+func TestSecret_DeletionAndReappearance(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+	statuses, err := secret.ListenStatus()
+	require.NoError(t, err)
+
+	// present -> missing
+	mfs.RemoveFile("/mnt/secrets_store/token")
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Remove)
+
+	status := receiveStatus(t, statuses)
+	assert.Equal(t, "token", status.Key)
+	assert.True(t, status.Missing)
+	assert.False(t, status.StaleSince.IsZero())
+
+	since, stale := secret.StaleSince()
+	assert.True(t, stale)
+	assert.Equal(t, status.StaleSince, since)
+	assert.Equal(t, "v1", secret.Value(), "last good value is kept while missing")
+
+	// missing -> present again, with normal delivery resuming
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Create)
+
+	status = receiveStatus(t, statuses)
+	assert.False(t, status.Missing)
+	assert.True(t, status.StaleSince.IsZero())
+
+	select {
+	case value, ok := <-changes:
+		require.True(t, ok, "change channel must survive the deletion")
+		assert.Equal(t, "v2", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+
+	_, stale = secret.StaleSince()
+	assert.False(t, stale)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v3"))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v3", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+}
+
+func TestSecret_RenamedAwayIsMissing(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	statuses, err := secret.ListenStatus()
+	require.NoError(t, err)
+
+	mfs.RemoveFile("/mnt/secrets_store/token")
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Rename)
+
+	assert.True(t, receiveStatus(t, statuses).Missing)
+}
+
+func TestSecret_ListenStatusContext(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	statuses, err := secret.ListenStatusContext(ctx)
+	require.NoError(t, err)
+
+	mfs.RemoveFile("/mnt/secrets_store/token")
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Remove)
+	assert.True(t, receiveStatus(t, statuses).Missing)
+
+	cancel()
+	select {
+	case _, open := <-statuses:
+		assert.False(t, open, "channel should be closed once the context is cancelled")
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after the context was cancelled")
+	}
+
+	// Later statuses are not sent to the removed channel, and closing the loader does not
+	// close it twice
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Create)
+	loader.Close()
+}
+
+// failingReader fails every read while fail is set
+type failingReader struct {
+	secrets.FileReader
+	fail atomic.Bool
+}
+
+func (r *failingReader) ReadFile(path string) ([]byte, error) {
+	if r.fail.Load() {
+		return nil, errors.New("permission denied")
+	}
+	return r.FileReader.ReadFile(path)
+}
+
+func TestSecret_ReadFailureKeepsSubscribers(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	reader := &failingReader{FileReader: mfs}
+
+	loader, _, mwf := newMockLoader(t, secrets.WithFileReader(reader))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	reader.fail.Store(true)
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+
+	reader.fail.Store(false)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+
+	select {
+	case value, ok := <-changes:
+		require.True(t, ok, "a failed read must not close the subscribers")
+		assert.Equal(t, "v2", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+}
+
+func TestSecret_ClearsWatcherErrorOnceWatchedAgain(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithWatcherBackoff(5*time.Millisecond, 20*time.Millisecond))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	// Keeps the file watched without having to read the changes
+	_, err = secret.Subscribe(secrets.LatestValueWins())
+	require.NoError(t, err)
+
+	recreate := func(content string) {
+		mfs.RemoveFile("/mnt/secrets_store/token")
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Remove)
+		require.Eventually(t, func() bool {
+			_, stale := secret.StaleSince()
+			return stale
+		}, time.Second, time.Millisecond)
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(content))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Create)
+		require.Eventually(t, func() bool { return secret.Value() == content }, time.Second, time.Millisecond)
+	}
+
+	// The recreated file cannot be watched
+	mwf.GetWatcher().FailAdds(1)
+	recreate("v2")
+	assert.ErrorIs(t, secret.Err(), secrets.ErrWatcherFailed)
+
+	// Watching it again on the next recreation clears the error
+	recreate("v3")
+	assert.NoError(t, secret.Err())
+
+	// So does a recovered watcher
+	mwf.GetWatcher().FailAdds(1)
+	recreate("v4")
+	require.ErrorIs(t, secret.Err(), secrets.ErrWatcherFailed)
+	mwf.GetWatcher().SimulateError(errors.New("inotify queue overflow"))
+	require.Eventually(t, func() bool {
+		return loader.Status().Recoveries == 1
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, secret.Err())
+}
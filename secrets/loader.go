@@ -2,30 +2,120 @@ package secrets
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
 const DefaultBasePath = "/mnt/secrets_store"
 
+// kubernetesDataDir is the symlink that the Kubernetes atomic writer (used by secret
+// volumes and the Secrets Store CSI driver) swaps to publish a new set of files.
+const kubernetesDataDir = "..data"
+
 // Secret represents a watchable secret with change notifications
 type Secret interface {
 	Value() string
+	// Bytes returns a copy of the current value
+	Bytes() []byte
+	// AppendBytes appends the current value to dst and returns the extended slice
+	AppendBytes(dst []byte) []byte
+	// Reader opens the secret file for streaming, within the size limit of the secret. The
+	// caller must close it.
+	Reader() (io.ReadCloser, error)
 	// ListenChanges returns a new dedicated channel for receiving secret updates.
 	// The returned channel will be closed when the secret will not be watched anymore, this could be due to an error.
 	ListenChanges() (<-chan string, error) // Each call returns a new dedicated channel
+	// Subscribe is like ListenChanges, with control over what happens when the subscriber
+	// falls behind. By default the channel is closed, as with ListenChanges.
+	Subscribe(opts ...SubscribeOption) (*Subscription[string], error)
+	// SubscribeBytes is like Subscribe, with the new values delivered as the bytes that were
+	// read. The slices are shared and must not be modified.
+	SubscribeBytes(opts ...SubscribeOption) (*Subscription[[]byte], error)
+	// ListenChangesContext is like ListenChanges, but the channel is closed and the
+	// subscriber removed as soon as ctx ends
+	ListenChangesContext(ctx context.Context) (<-chan string, error)
+	// OnChange calls fn on a separate goroutine every time the secret changes. Panics are
+	// recovered, and the returned Registration removes the callback.
+	OnChange(fn ChangeFunc, opts ...CallbackOption) (*Registration, error)
+	// ListenEvents delivers a ChangeEvent describing every change of the secret
+	ListenEvents(opts ...SubscribeOption) (*Subscription[ChangeEvent], error)
+	// Version returns the version of the current value. It starts at 1 and is incremented
+	// on every change.
+	Version() uint64
+	// Current returns the current value together with its version
+	Current() SecretVersion
+	// Previous returns the value before the current one while it is kept in the history,
+	// see WithHistory
+	Previous() (SecretVersion, bool)
+	// History returns the current value followed by the previous values that are kept,
+	// newest first
+	History() []SecretVersion
+	// ListenStatus returns a new dedicated channel that receives the latest SecretStatus
+	// whenever the secret file disappears or is created again.
+	ListenStatus() (<-chan SecretStatus, error)
+	// ListenStatusContext is like ListenStatus, but the channel is closed and removed as
+	// soon as ctx ends
+	ListenStatusContext(ctx context.Context) (<-chan SecretStatus, error)
+	// StaleSince reports since when the secret file has been missing.
+	// The boolean is false while the file is present.
+	StaleSince() (time.Time, bool)
+	// Err returns the current error of the secret, e.g. a failed read (ErrReadFailed) while
+	// the last good value is still served. Once Done is closed it is the reason the secret
+	// was closed.
+	Err() error
+	// Done returns a channel that is closed once the secret is not watched anymore
+	Done() <-chan struct{}
+}
+
+// SecretStatus describes whether the file backing a secret is currently present
+type SecretStatus struct {
+	Key     string
+	Missing bool
+	// StaleSince is when the file went missing, zero while it is present
+	StaleSince time.Time
 }
 
 // SecretLoader defines the interface for loading secrets (Port in Hexagonal Architecture)
 type SecretLoader interface {
-	GetSecret(secretKey string) (Secret, error)
+	// GetSecret loads the secret stored under the given key. Keys are slash-separated
+	// paths relative to the base path, e.g. "db/primary/password". The options override
+	// the loader defaults, also for a secret that was already loaded, where they only change
+	// the settings they are about.
+	GetSecret(secretKey string, opts ...SecretOption) (Secret, error)
+	// GetJSONDocument loads the secret stored under the given key as a JSON document, from
+	// which secrets for single fields can be derived
+	GetJSONDocument(secretKey string, opts ...SecretOption) (*Document, error)
+	// GetDocument is like GetJSONDocument for documents of the given format, or of the
+	// format matching the extension of the key with FormatAuto
+	GetDocument(secretKey string, format Format, opts ...SecretOption) (*Document, error)
 	Close()
+	// ListSecretKeys lists the keys of all secrets, including the ones in subdirectories
 	ListSecretKeys() ([]string, error)
+	// ListSecretKeysWithPrefix lists the keys of all secrets starting with the given prefix
+	ListSecretKeysWithPrefix(prefix string) ([]string, error)
+	// OnChange calls fn on a separate goroutine every time a secret returned by GetSecret
+	// changes. Panics are recovered, and the returned Registration removes the callback.
+	OnChange(fn KeyChangeFunc, opts ...CallbackOption) (*Registration, error)
+	// Status reports whether changes are currently being watched
+	Status() LoaderStatus
+	// WaitForSecrets blocks until all given secrets exist and are not empty, or ctx ends
+	WaitForSecrets(ctx context.Context, keys ...string) error
+	// Err returns the current error of the loader, e.g. a failed watcher (ErrWatcherFailed)
+	// while it is being rebuilt. Once Done is closed it is the reason the loader was closed:
+	// ErrLoaderClosed, also matching the context error when the context ended.
+	Err() error
+	// Done returns a channel that is closed once the loader was closed
+	Done() <-chan struct{}
 }
 
 type fileSecretLoader struct {
@@ -36,19 +126,45 @@ type fileSecretLoader struct {
 	closeOnce      sync.Once
 	reader         FileReader
 	watcherFactory FileWatcherFactory
-	watcher        FileWatcher
+	watcher        ConcurrentValue[FileWatcher]
+	watcherMu      sync.Mutex
+	backoff        backoffPolicy
+	status         ConcurrentValue[LoaderStatus]
 	secrets        ConcurrentMap[string, *fileSecret]
-	err            ConcurrentValue[error]
-}
-
-// subscriberInfo holds channel and failure tracking
-type subscriberInfo struct {
-	ch chan string
+	// parts indexes the secrets holding a part of a file, like a field or a dotenv
+	// variable, by the key of the file
+	parts        ConcurrentMap[string, []*fileSecret]
+	watchedDirs  ConcurrentMap[string, bool]
+	hooks        ConcurrentList[*callbackWorker]
+	hooksMu      sync.Mutex
+	settleWindow time.Duration
+	rejectEmpty  bool
+	secretConfig secretConfig
+	dotenvFiles  []string
+	required     []string
+	changed      chan struct{}
+	changedMu    sync.Mutex
+	done         chan struct{}
+	err          ConcurrentValue[error]
 }
 
 // Option defines a functional option for configuring the secret loader
 type Option func(*fileSecretLoader)
 
+// SecretOption configures a single secret, see SecretLoader.GetSecret
+type SecretOption func(*secretConfig)
+
+// secretConfig holds the settings of a secret. The loader options set the defaults, and the
+// options passed to GetSecret are applied on top of the settings the secret already has.
+type secretConfig struct {
+	historyDepth int
+	historyGrace time.Duration
+	validators   []Validator
+	// formats are the document formats the values must be valid in, see GetDocument
+	formats []Format
+	maxSize int64
+}
+
 // WithBasePath sets a custom base path for the secret loader
 func WithBasePath(basePath string) Option {
 	return func(fsl *fileSecretLoader) {
@@ -70,6 +186,49 @@ func WithWatcherFactory(factory FileWatcherFactory) Option {
 	}
 }
 
+// WithWatcherBackoff sets the exponential backoff between attempts to rebuild a failed file
+// watcher, starting at initial and doubling up to maximum. The initial backoff is at least
+// one millisecond, and maximum is raised to initial if it is lower.
+func WithWatcherBackoff(initial, maximum time.Duration) Option {
+	return func(fsl *fileSecretLoader) {
+		initial = max(initial, minWatcherBackoff)
+		fsl.backoff = backoffPolicy{initial: initial, max: max(maximum, initial)}
+	}
+}
+
+// WithPollingWatcher makes the loader poll for changes on the given interval instead of
+// relying on fsnotify, for file systems that do not deliver inotify events
+func WithPollingWatcher(interval time.Duration) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.watcherFactory = &pollingWatcherFactory{interval: interval}
+	}
+}
+
+// WithAutoWatcher uses fsnotify and falls back to polling on the given interval when fsnotify
+// cannot be initialised or the base path is on a file system that does not deliver events
+func WithAutoWatcher(interval time.Duration) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.watcherFactory = &autoWatcherFactory{interval: interval}
+	}
+}
+
+// WithSettleWindow delays reloads until a secret file has not changed for the given window,
+// so that a rotation written in several steps is published once. A reload is only published
+// when two reads one window apart return the same content.
+func WithSettleWindow(window time.Duration) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.settleWindow = window
+	}
+}
+
+// WithRejectEmpty treats empty secret files as a transient state, e.g. a file that was
+// truncated before being rewritten. Empty content is never published.
+func WithRejectEmpty() Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.rejectEmpty = true
+	}
+}
+
 // NewFileSecretLoader creates a new fileSecretLoader with optional configuration
 func NewFileSecretLoader(ctx context.Context, opts ...Option) (SecretLoader, error) {
 	childCtx, cancelFunc := context.WithCancel(ctx)
@@ -82,6 +241,21 @@ func NewFileSecretLoader(ctx context.Context, opts ...Option) (SecretLoader, err
 		secrets: ConcurrentMap[string, *fileSecret]{
 			value: make(map[string]*fileSecret),
 		},
+		parts: ConcurrentMap[string, []*fileSecret]{
+			value: make(map[string][]*fileSecret),
+		},
+		watchedDirs: ConcurrentMap[string, bool]{
+			value: make(map[string]bool),
+		},
+		backoff: backoffPolicy{
+			initial: defaultWatcherBackoff,
+			max:     defaultWatcherMaxBackoff,
+		},
+		status: ConcurrentValue[LoaderStatus]{
+			value: LoaderStatus{Healthy: true},
+		},
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 
 	// Apply all provided options
@@ -89,70 +263,168 @@ func NewFileSecretLoader(ctx context.Context, opts ...Option) (SecretLoader, err
 		opt(fsl)
 	}
 
+	// Built-in watchers read through the configured reader, which is only known now
+	switch factory := fsl.watcherFactory.(type) {
+	case *pollingWatcherFactory:
+		if factory.reader == nil {
+			factory.reader = fsl.reader
+		}
+	case *autoWatcherFactory:
+		if factory.reader == nil {
+			factory.reader = fsl.reader
+		}
+		factory.basePath = fsl.basePath
+	}
+
 	watcher, err := fsl.watcherFactory.NewFileWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file watcher: %w", err)
 	}
-	fsl.watcher = watcher
+	fsl.watcher.Set(watcher)
 
 	err = fsl.startWatching()
+	if err != nil {
+		return fsl, err
+	}
 
-	return fsl, err
+	if err := fsl.preloadRequired(); err != nil {
+		fsl.Close()
+		return nil, err
+	}
+
+	return fsl, nil
 }
 
+// ListSecretKeys lists the keys of all secrets below the base path, including nested ones
 func (fsl *fileSecretLoader) ListSecretKeys() ([]string, error) {
+	return fsl.ListSecretKeysWithPrefix("")
+}
+
+// ListSecretKeysWithPrefix lists the keys of all secrets that start with the given
+// slash-separated prefix, e.g. "db/" lists every secret below the db directory
+func (fsl *fileSecretLoader) ListSecretKeysWithPrefix(prefix string) ([]string, error) {
 	keys := []string{}
 
 	if fsl.isClosed.Get() {
-		return keys, fmt.Errorf("secret loader is closed")
+		return keys, ErrLoaderClosed
+	}
+
+	// Only the deepest directory named by the prefix has to be walked
+	dirKey := ""
+	if i := strings.LastIndex(prefix, "/"); i > 0 {
+		cleaned, err := cleanSecretKey(prefix[:i])
+		if err != nil {
+			return keys, fmt.Errorf("invalid secret key prefix: %s", prefix)
+		}
+		dirKey = cleaned
+	}
+
+	dir := filepath.Join(fsl.basePath, filepath.FromSlash(dirKey))
+	entries, err := fsl.reader.ReadDir(dir)
+	if err != nil {
+		if dirKey != "" && os.IsNotExist(err) {
+			return keys, nil
+		}
+		return keys, fmt.Errorf("failed to read secrets directory: %w", err)
 	}
 
-	entries, err := fsl.reader.ReadDir(fsl.basePath)
+	found, err := fsl.collectKeys(dirKey, entries)
 	if err != nil {
 		return keys, fmt.Errorf("failed to read secrets directory: %w", err)
 	}
 
-	for _, entry := range entries {
-		// Filter: only regular files, exclude hidden files
-		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
-			keys = append(keys, entry.Name())
+	virtual, err := fsl.dotenvKeys()
+	if err != nil {
+		return keys, fmt.Errorf("failed to read dotenv file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range append(found, virtual...) {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
 		}
 	}
+	sort.Strings(keys)
 
 	return keys, nil
 }
 
 // GetSecret loads a secret and returns a Secret object that can be watched for changes
-func (fsl *fileSecretLoader) GetSecret(secretKey string) (Secret, error) {
+func (fsl *fileSecretLoader) GetSecret(secretKey string, opts ...SecretOption) (Secret, error) {
+	secret, err := fsl.loadSecret(secretKey, nil, opts)
+	if errors.Is(err, ErrSecretNotFound) && len(fsl.dotenvFiles) > 0 {
+		if variable, dotenvErr := fsl.getDotenvSecret(secretKey, opts); !errors.Is(dotenvErr, ErrSecretNotFound) {
+			secret, err = variable, dotenvErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// loadSecret returns the secret of a file, or of a part of the file when field is set,
+// loading it on first use
+func (fsl *fileSecretLoader) loadSecret(secretKey string, field projection, opts []SecretOption) (*fileSecret, error) {
 
 	if fsl.isClosed.Get() {
-		return nil, fmt.Errorf("secret loader is closed")
+		return nil, ErrLoaderClosed
 	}
 
-	if secretKey == "" {
-		return nil, fmt.Errorf("secret key cannot be empty")
+	secretKey, err := cleanSecretKey(secretKey)
+	if err != nil {
+		return nil, err
 	}
 
-	if secret, exists := fsl.secrets.Get(secretKey); exists {
+	mapKey, id := secretKey, secretKey
+	if field != nil {
+		id = field.key(secretKey)
+		mapKey = fieldKey(secretKey, id)
+	}
+
+	if secret, exists := fsl.secrets.Get(mapKey); exists {
+		if len(opts) > 0 {
+			secret.configure(opts)
+		}
 		return secret, nil // Return existing secret if already loaded
 	}
 
-	secretPath := filepath.Join(fsl.basePath, secretKey)
+	config := fsl.secretConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	secretPath := filepath.Join(fsl.basePath, filepath.FromSlash(secretKey))
 
 	// Check if file exists and read initial value
 	//if _, err := os.Stat(secretPath); os.IsNotExist(err) {
 	if _, err := fsl.reader.Stat(secretPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("secret file not found: %s", secretPath)
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, secretPath)
 	}
 
-	content, err := fsl.reader.ReadFile(secretPath)
+	content, err := readSecretFile(fsl.reader, secretPath, config.maxSize)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read secret file %s: %w", secretPath, err)
+		return nil, fmt.Errorf("%w %s: %w", ErrReadFailed, secretPath, err)
+	}
+
+	if fsl.rejectEmpty && len(content) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSecretEmpty, secretPath)
+	}
+
+	if field != nil {
+		if content, err = field.project(id, content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validate(config.allValidators(), id, string(content)); err != nil {
+		return nil, err
 	}
 
 	result := &fileSecret{
 		ctx:            fsl.ctx,
-		id:             secretKey,
+		id:             id,
 		path:           secretPath,
 		reader:         fsl.reader,
 		watcherFactory: fsl.watcherFactory,
@@ -160,14 +432,33 @@ func (fsl *fileSecretLoader) GetSecret(secretKey string) (Secret, error) {
 			value: string(content),
 		},
 		watcher: ConcurrentValue[FileWatcher]{
-			value: fsl.watcher,
+			value: fsl.watcher.Get(),
 		},
-		subscribers: ConcurrentList[subscriberInfo]{},
-		closed:      ConcurrentValue[bool]{},
-		err:         ConcurrentValue[error]{},
+		done:         make(chan struct{}),
+		subscribers:  ConcurrentList[listener]{},
+		closed:       ConcurrentValue[bool]{},
+		err:          ConcurrentValue[error]{},
+		settleWindow: fsl.settleWindow,
+		rejectEmpty:  fsl.rejectEmpty,
+		history:      newVersionHistory(string(content), config),
+		config:       config,
+		validators:   ConcurrentValue[[]Validator]{value: config.allValidators()},
+		maxSize:      ConcurrentValue[int64]{value: config.maxSize},
+		field:        field,
 	}
 
-	fsl.secrets.Set(secretKey, result)
+	result.version.Store(1)
+
+	fsl.hooksMu.Lock()
+	defer fsl.hooksMu.Unlock()
+	if err := fsl.attachHooks(result); err != nil {
+		result.Close()
+		return nil, err
+	}
+	fsl.secrets.Set(mapKey, result)
+	if field != nil {
+		fsl.indexPart(secretKey, result)
+	}
 	return result, nil
 }
 
@@ -178,49 +469,51 @@ func (fsl *fileSecretLoader) GetBasePath() string {
 
 func (fsl *fileSecretLoader) Close() {
 	fsl.closeOnce.Do(func() {
+		// The context is only done at this point when the caller's context ended
+		reason := ErrLoaderClosed
+		if ctxErr := fsl.ctx.Err(); ctxErr != nil {
+			reason = fmt.Errorf("%w: %w", ErrLoaderClosed, ctxErr)
+		}
+
 		fsl.isClosed.Set(true)
 		// signal startWatching loop to exit
 		fsl.cancelCtxFn()
 
+		fsl.stopHooks()
 		for k, v := range fsl.secrets.CopyMap() {
-			v.Close()          // Close each secret to release resources
-			fsl.secrets.Del(k) // Remove from the loader's map
+			v.closeWithError(reason) // Close each secret to release resources
+			fsl.secrets.Del(k)       // Remove from the loader's map
 		}
-
-		if fsl.watcher != nil {
-			if err := fsl.watcher.Close(); err != nil {
-				fsl.setError(fmt.Errorf("failed to close watcher: %w", err))
+		for k := range fsl.parts.CopyMap() {
+			fsl.parts.Del(k)
+		}
+		defer close(fsl.done)
+
+		// A watcher being rebuilt concurrently is closed by recoverWatcher
+		fsl.watcherMu.Lock()
+		defer fsl.watcherMu.Unlock()
+		if watcher := fsl.watcher.Get(); watcher != nil {
+			if err := watcher.Close(); err != nil {
+				reason = errors.Join(reason, fmt.Errorf("failed to close watcher: %w", err))
 			}
 		}
+		fsl.setError(reason)
 	})
 }
 
 func (fsl *fileSecretLoader) startWatching() error {
-	err := fsl.watcher.Add(fsl.basePath)
+	err := fsl.watchTree(fsl.basePath)
 	if err != nil {
 		return fmt.Errorf("failed to add base path to watcher: %w", err)
 	}
 	go func() {
 		defer fsl.Close()
 		for {
-			select {
-			case event, isOpen := <-fsl.watcher.Events():
-				if !isOpen {
-					return
-				}
-
-				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) {
-					fsl.handleFileChange(event.String())
-				}
-
-			case errW, isOpen := <-fsl.watcher.Errors():
-				if !isOpen {
-					return
-				}
-				fsl.setError(errW)
+			failure := fsl.processEvents(fsl.watcher.Get())
+			if failure == nil {
 				return
-
-			case <-fsl.ctx.Done():
+			}
+			if !fsl.recoverWatcher(failure) {
 				return
 			}
 		}
@@ -228,11 +521,117 @@ func (fsl *fileSecretLoader) startWatching() error {
 	return nil
 }
 
+// processEvents handles the events of a watcher until the loader is closed, in which case
+// it returns nil, or until the watcher fails, in which case it returns the failure
+func (fsl *fileSecretLoader) processEvents(watcher FileWatcher) error {
+	for {
+		select {
+		case event, isOpen := <-watcher.Events():
+			if !isOpen {
+				return fsl.watcherClosedError()
+			}
+			fsl.handleEvent(event)
+			fsl.signalChange()
+
+		case errW, isOpen := <-watcher.Errors():
+			if !isOpen {
+				return fsl.watcherClosedError()
+			}
+			return errW
+
+		case <-fsl.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// watcherClosedError tells a watcher closed by Close apart from one that stopped on its own
+func (fsl *fileSecretLoader) watcherClosedError() error {
+	if fsl.ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("file watcher stopped unexpectedly")
+}
+
+func (fsl *fileSecretLoader) handleEvent(event fsnotify.Event) {
+	if fsl.isAtomicSwap(event) {
+		fsl.handleAtomicSwap(filepath.Dir(filepath.Clean(event.Name)))
+		return
+	}
+
+	if event.Has(fsnotify.Create) && fsl.isVisibleDir(event.Name) {
+		fsl.handleDirCreated(event.Name)
+		return
+	}
+
+	if (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)) && fsl.isWatchedDir(event.Name) {
+		fsl.handleDirRemoved(event.Name)
+		return
+	}
+
+	if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) ||
+		event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		fsl.handleFileChange(event.Name)
+	}
+}
+
+// handleFileChange routes a file event to the secret loaded for exactly that path
 func (fsl *fileSecretLoader) handleFileChange(filePath string) {
-	for k, fs := range fsl.secrets.CopyMap() {
-		if strings.Contains(filePath, k) {
-			fs.handleFileChange()
+	key, ok := fsl.keyForPath(filePath)
+	if !ok {
+		return
+	}
+	for _, fs := range fsl.secretsOfFile(key) {
+		fs.scheduleReload()
+	}
+}
+
+// keyForPath maps a watched file path back to the secret key it belongs to
+func (fsl *fileSecretLoader) keyForPath(filePath string) (string, bool) {
+	rel, err := filepath.Rel(fsl.basePath, filepath.Clean(filePath))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// cleanSecretKey normalizes a secret key so that every spelling of the same file maps to
+// a single entry, and rejects keys that would resolve outside of the base path
+func cleanSecretKey(secretKey string) (string, error) {
+	if secretKey == "" {
+		return "", fmt.Errorf("secret key cannot be empty")
+	}
+	key := path.Clean(filepath.ToSlash(secretKey))
+	if path.IsAbs(key) || key == "." || key == ".." || strings.HasPrefix(key, "../") {
+		return "", fmt.Errorf("invalid secret key: %s", secretKey)
+	}
+	return key, nil
+}
+
+// isAtomicSwap reports whether the event is the atomic writer replacing the ..data symlink
+// of the base path or of a watched directory below it, where a secret volume may be mounted.
+// The rename of ..data_tmp onto ..data is delivered as a Create for ..data.
+func (fsl *fileSecretLoader) isAtomicSwap(event fsnotify.Event) bool {
+	name := filepath.Clean(event.Name)
+	if !event.Has(fsnotify.Create) || filepath.Base(name) != kubernetesDataDir {
+		return false
+	}
+	dir := filepath.Dir(name)
+	return dir == filepath.Clean(fsl.basePath) || fsl.isWatchedDir(dir)
+}
+
+// handleAtomicSwap re-resolves every loaded secret below dir after its ..data symlink was
+// swapped. Watches on the secret paths and nested directories still point at the previous
+// inodes, so they are re-added before the content is re-read.
+func (fsl *fileSecretLoader) handleAtomicSwap(dir string) {
+	fsl.rewatchDirs()
+	prefix := dir + string(filepath.Separator)
+	for _, fs := range fsl.secrets.CopyMap() {
+		if !strings.HasPrefix(fs.path, prefix) {
+			continue
 		}
+		fs.rewatch()
+		fs.handleFileChange(CauseRotation)
 	}
 }
 
@@ -240,6 +639,13 @@ func (fsl *fileSecretLoader) setError(err error) {
 	fsl.err.Set(err)
 }
 
+// Err returns the current error of the loader. Once Done is closed it is the reason the
+// loader was closed.
 func (fsl *fileSecretLoader) Err() error {
 	return fsl.err.Get()
 }
+
+// Done returns a channel that is closed once the loader was closed
+func (fsl *fileSecretLoader) Done() <-chan struct{} {
+	return fsl.done
+}
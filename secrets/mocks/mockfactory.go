@@ -1,10 +1,19 @@
 package mocks
 
-import "github.com/stable-io/commons-go/secrets"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/stable-io/commons-go/secrets"
+)
 
 // MockWatcherFactory implements FileWatcherFactory for testing
 type MockWatcherFactory struct {
-	watcher *MockFileWatcher
+	mu       sync.Mutex
+	watcher  *MockFileWatcher
+	failures int
+	created  int
+	attempts int
 }
 
 // NewMockWatcherFactory creates a new mock watcher factory
@@ -14,12 +23,49 @@ func NewMockWatcherFactory() *MockWatcherFactory {
 	}
 }
 
-// NewFileWatcher implements FileWatcherFactory interface
+// NewFileWatcher implements FileWatcherFactory interface.
+// The same watcher is returned until it is closed, after which a new one is created.
 func (m *MockWatcherFactory) NewFileWatcher() (secrets.FileWatcher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts++
+	if m.failures > 0 {
+		m.failures--
+		return nil, fmt.Errorf("mock watcher factory failure")
+	}
+
+	if m.watcher.IsClosed() {
+		m.watcher = NewMockFileWatcher()
+	}
+	m.created++
 	return m.watcher, nil
 }
 
 // GetWatcher returns the underlying mock watcher for test control
 func (m *MockWatcherFactory) GetWatcher() *MockFileWatcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.watcher
 }
+
+// FailNext makes the next n calls to NewFileWatcher fail
+func (m *MockWatcherFactory) FailNext(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = n
+}
+
+// Created returns how many watchers were handed out
+func (m *MockWatcherFactory) Created() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.created
+}
+
+// Attempts returns how many times NewFileWatcher was called, including failed calls
+func (m *MockWatcherFactory) Attempts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts
+}
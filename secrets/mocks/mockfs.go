@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,6 +28,7 @@ func (m *mockFileInfo) Sys() interface{}   { return nil }
 // MockFileSystem provides a deterministic in-memory file system for testing
 type MockFileSystem struct {
 	files     map[string][]byte
+	modTimes  map[string]time.Time
 	dirs      map[string]bool
 	mu        sync.RWMutex
 	writeChan chan string
@@ -36,6 +38,7 @@ type MockFileSystem struct {
 func NewMockFileSystem() *MockFileSystem {
 	return &MockFileSystem{
 		files:     make(map[string][]byte),
+		modTimes:  make(map[string]time.Time),
 		dirs:      make(map[string]bool),
 		writeChan: make(chan string, 100),
 	}
@@ -50,13 +53,34 @@ func (m *MockFileSystem) WriteFile(path string, content []byte) {
 	contentCopy := make([]byte, len(content))
 	copy(contentCopy, content)
 
+	now := time.Now()
+	if _, exists := m.files[path]; !exists {
+		// Like a real directory, the parent changes when an entry is added
+		m.modTimes[filepath.Dir(path)] = now
+	}
 	m.files[path] = contentCopy
+	m.modTimes[path] = now
 
-	// Ensure the directory exists
-	dir := filepath.Dir(path)
-	m.dirs[dir] = true
+	// Ensure the directory and all of its parents exist
+	for dir := filepath.Dir(path); !m.dirs[dir]; dir = filepath.Dir(dir) {
+		m.dirs[dir] = true
+		m.modTimes[dir] = now
+	}
 
-	m.writeChan <- path
+	// Never block writers on an unread notification channel
+	select {
+	case m.writeChan <- path:
+	default:
+	}
+}
+
+// RemoveFile deletes a file
+func (m *MockFileSystem) RemoveFile(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, path)
+	delete(m.modTimes, path)
+	m.modTimes[filepath.Dir(path)] = time.Now()
 }
 
 // CreateDir creates a directory entry
@@ -64,6 +88,24 @@ func (m *MockFileSystem) CreateDir(path string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.dirs[path] = true
+	m.modTimes[path] = time.Now()
+}
+
+// RemoveDir deletes a directory together with everything below it
+func (m *MockFileSystem) RemoveDir(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := path + string(filepath.Separator)
+	for dir := range m.dirs {
+		if dir == path || strings.HasPrefix(dir, prefix) {
+			delete(m.dirs, dir)
+		}
+	}
+	for file := range m.files {
+		if strings.HasPrefix(file, prefix) {
+			delete(m.files, file)
+		}
+	}
 }
 
 // ReadFile reads content from a file
@@ -87,6 +129,15 @@ func (m *MockFileSystem) Stat(name string) (fs.FileInfo, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	if m.dirs[name] {
+		return &mockFileInfo{
+			name:    filepath.Base(name),
+			mode:    fs.ModeDir | 0755,
+			modTime: m.modTimes[name],
+			isDir:   true,
+		}, nil
+	}
+
 	content, exists := m.files[name]
 	if !exists {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
@@ -96,7 +147,7 @@ func (m *MockFileSystem) Stat(name string) (fs.FileInfo, error) {
 		name:    name,
 		size:    int64(len(content)),
 		mode:    0644,
-		modTime: time.Now(),
+		modTime: m.modTimes[name],
 		isDir:   false,
 	}, nil
 }
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -15,6 +16,7 @@ type MockFileWatcher struct {
 	mu        sync.RWMutex
 	closed    bool
 	closeOnce sync.Once
+	failAdds  int
 }
 
 // NewMockFileWatcher creates a new mock file watcher
@@ -34,11 +36,22 @@ func (m *MockFileWatcher) Add(path string) error {
 	if m.closed {
 		return fmt.Errorf("watcher is closed")
 	}
+	if m.failAdds > 0 {
+		m.failAdds--
+		return fmt.Errorf("mock watcher add failure")
+	}
 
 	m.watched[path] = true
 	return nil
 }
 
+// FailAdds makes the next n calls to Add fail
+func (m *MockFileWatcher) FailAdds(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failAdds = n
+}
+
 // Remove removes a path from watching
 func (m *MockFileWatcher) Remove(path string) error {
 	m.mu.Lock()
@@ -91,6 +104,38 @@ func (m *MockFileWatcher) SimulateWrite(path string) {
 	}
 }
 
+// SimulateEvent simulates an arbitrary event. Like inotify, the event is delivered when
+// either the path itself or its parent directory is being watched.
+func (m *MockFileWatcher) SimulateEvent(path string, op fsnotify.Op) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return
+	}
+
+	if m.watched[path] || m.watched[filepath.Dir(path)] {
+		m.events <- fsnotify.Event{
+			Name: path,
+			Op:   op,
+		}
+	}
+}
+
+// IsClosed reports whether the watcher was closed
+func (m *MockFileWatcher) IsClosed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.closed
+}
+
+// IsWatched reports whether the path is currently being watched
+func (m *MockFileWatcher) IsWatched(path string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.watched[path]
+}
+
 // SimulateError simulates a watcher error
 func (m *MockFileWatcher) SimulateError(err error) {
 	m.mu.RLock()
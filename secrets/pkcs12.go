@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// PKCS12Bundle is the content of a PKCS#12 (.p12 or .pfx) file
+type PKCS12Bundle struct {
+	// Certificate holds the private key and the certificate, followed by the CA chain
+	Certificate tls.Certificate
+	// CACertificates is the CA chain delivered with the certificate
+	CACertificates []*x509.Certificate
+}
+
+// DecodePKCS12 decodes a binary PKCS#12 bundle holding a private key, its certificate and
+// optionally a CA chain. Trailing line breaks of the password are ignored, since password
+// files usually end with one.
+func DecodePKCS12(bundle, password string) (*PKCS12Bundle, error) {
+	key, leaf, caCerts, err := pkcs12.DecodeChain([]byte(bundle), strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecodeFailed, err)
+	}
+	if _, ok := key.(crypto.Signer); !ok {
+		return nil, fmt.Errorf("%w: unsupported private key type %T", ErrDecodeFailed, key)
+	}
+
+	certificate := tls.Certificate{PrivateKey: key, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+	for _, caCert := range caCerts {
+		certificate.Certificate = append(certificate.Certificate, caCert.Raw)
+	}
+	return &PKCS12Bundle{Certificate: certificate, CACertificates: caCerts}, nil
+}
+
+// NewPKCS12Source loads a binary PKCS#12 bundle and the password protecting it, stored
+// under the given keys. The certificate is reloaded when either of them rotates. A bundle
+// that cannot be decoded with the current password is rejected like by a validator: Err
+// reports ErrValidationFailed and the previous certificate is still served, so a bundle
+// rotated before its password never breaks the TLS config. The CA chain of the bundle is
+// available from CACertificates.
+func NewPKCS12Source(loader SecretLoader, bundleKey, passwordKey string) (*CertificateSource, error) {
+	bundle, err := loader.GetSecret(bundleKey)
+	if err != nil {
+		return nil, err
+	}
+	password, err := loader.GetSecret(passwordKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCertificateSource([]Secret{bundle, password}, func() (*tls.Certificate, []*x509.Certificate, error) {
+		decoded, err := DecodePKCS12(bundle.Value(), password.Value())
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w for secret %s: %w", ErrValidationFailed, bundleKey, err)
+		}
+		return &decoded.Certificate, decoded.CACertificates, nil
+	})
+}
@@ -0,0 +1,89 @@
+package secrets_test
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func newTestPKCS12(t *testing.T, c *testCert, ca *testCert, password string) string {
+	t.Helper()
+	bundle, err := pkcs12.Modern.Encode(c.key, c.cert, []*x509.Certificate{ca.cert}, password)
+	require.NoError(t, err)
+	return string(bundle)
+}
+
+func TestPKCS12Source_ReloadsWhenBundleAndPasswordMatch(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	ca := newTestCA(t, "vendor-ca")
+	first := newTestCert(t, certTemplate("client-1", time.Now().Add(time.Hour)), ca)
+	mfs.WriteFile("/mnt/secrets_store/vendor/client.p12", []byte(newTestPKCS12(t, first, ca, "first")))
+	mfs.WriteFile("/mnt/secrets_store/vendor/password", []byte("first\n"))
+
+	source, err := secrets.NewPKCS12Source(loader, "vendor/client.p12", "vendor/password")
+	require.NoError(t, err)
+	defer source.Close()
+
+	served := source.Certificate()
+	require.Len(t, served.Certificate, 2)
+	assert.Equal(t, first.cert.Raw, served.Certificate[0])
+	assert.Equal(t, ca.cert.Raw, served.Certificate[1])
+	require.Len(t, source.CACertificates(), 1)
+	assert.Equal(t, "CN=vendor-ca", source.CACertificates()[0].Subject.String())
+	assert.Equal(t, "CN=client-1", source.Info().Subject)
+
+	write := func(name, content string) {
+		mfs.WriteFile("/mnt/secrets_store/vendor/"+name, []byte(content))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/vendor/"+name, fsnotify.Write)
+	}
+
+	// The bundle was rotated before its password, the previous certificate is still served
+	second := newTestCert(t, certTemplate("client-2", time.Now().Add(time.Hour)), ca)
+	write("client.p12", newTestPKCS12(t, second, ca, "second"))
+	require.Eventually(t, func() bool { return source.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, source.Err(), secrets.ErrValidationFailed)
+	assert.ErrorIs(t, source.Err(), secrets.ErrDecodeFailed)
+	assert.Equal(t, first.cert.Raw, source.Certificate().Certificate[0])
+
+	write("password", "second")
+	require.Eventually(t, func() bool {
+		return source.Info().Subject == "CN=client-2"
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, source.Err())
+	assert.Equal(t, second.cert.Raw, source.Certificate().Certificate[0])
+}
+
+func TestPKCS12Source_RejectsInvalidInitialBundle(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	ca := newTestCA(t, "vendor-ca")
+	client := newTestCert(t, certTemplate("client", time.Now().Add(time.Hour)), ca)
+	mfs.WriteFile("/mnt/secrets_store/client.p12", []byte(newTestPKCS12(t, client, ca, "secret")))
+	mfs.WriteFile("/mnt/secrets_store/password", []byte("wrong"))
+
+	_, err := secrets.NewPKCS12Source(loader, "client.p12", "password")
+	assert.ErrorIs(t, err, secrets.ErrValidationFailed)
+
+	_, err = secrets.NewPKCS12Source(loader, "client.p12", "missing")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+}
+
+func TestDecodePKCS12(t *testing.T) {
+	ca := newTestCA(t, "vendor-ca")
+	client := newTestCert(t, certTemplate("client", time.Now().Add(time.Hour)), ca)
+
+	bundle, err := secrets.DecodePKCS12(newTestPKCS12(t, client, ca, "secret"), "secret\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, client.cert.Raw, bundle.Certificate.Leaf.Raw)
+	assert.Equal(t, client.key, bundle.Certificate.PrivateKey)
+	assert.Equal(t, []*x509.Certificate{ca.cert}, bundle.CACertificates)
+
+	_, err = secrets.DecodePKCS12("not a bundle", "secret")
+	assert.ErrorIs(t, err, secrets.ErrDecodeFailed)
+}
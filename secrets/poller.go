@@ -0,0 +1,329 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultPollInterval is the interval used by polling watchers when none is configured
+const DefaultPollInterval = 2 * time.Second
+
+// pollingWatcherFactory implements FileWatcherFactory with watchers that poll the file system
+type pollingWatcherFactory struct {
+	reader   FileReader
+	interval time.Duration
+}
+
+// NewPollingWatcherFactory returns a FileWatcherFactory for file systems that do not deliver
+// inotify events (NFS, FUSE, ...). Its watchers compare the modification time, size and
+// content hash of every watched path on each interval.
+func NewPollingWatcherFactory(reader FileReader, interval time.Duration) FileWatcherFactory {
+	return &pollingWatcherFactory{reader: reader, interval: interval}
+}
+
+func (f *pollingWatcherFactory) NewFileWatcher() (FileWatcher, error) {
+	return newPollingWatcher(f.reader, f.interval), nil
+}
+
+// autoWatcherFactory uses fsnotify, unless it cannot be initialised or the watched path is
+// on a file system that is known not to deliver events, in which case it polls
+type autoWatcherFactory struct {
+	reader   FileReader
+	basePath string
+	interval time.Duration
+}
+
+func (f *autoWatcherFactory) NewFileWatcher() (FileWatcher, error) {
+	if !deliversFileEvents(f.basePath) {
+		return newPollingWatcher(f.reader, f.interval), nil
+	}
+	watcher, err := (&fsNotifyWatcherFactory{}).NewFileWatcher()
+	if err != nil {
+		return newPollingWatcher(f.reader, f.interval), nil
+	}
+	return watcher, nil
+}
+
+// fileSnapshot is what the polling watcher compares between two polls
+type fileSnapshot struct {
+	isDir   bool
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// pollState holds the last snapshot of a watched path and, for directories, of its entries
+type pollState struct {
+	self    fileSnapshot
+	entries map[string]fileSnapshot
+}
+
+// pollingWatcher implements FileWatcher by periodically comparing snapshots.
+// Like fsnotify, watching a directory reports changes to its direct entries.
+type pollingWatcher struct {
+	reader    FileReader
+	interval  time.Duration
+	events    chan fsnotify.Event
+	errors    chan error
+	mu        sync.Mutex
+	watched   map[string]*pollState
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func newPollingWatcher(reader FileReader, interval time.Duration) *pollingWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	w := &pollingWatcher{
+		reader:   reader,
+		interval: interval,
+		events:   make(chan fsnotify.Event, 100),
+		errors:   make(chan error, 1),
+		watched:  make(map[string]*pollState),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *pollingWatcher) Add(path string) error {
+	path = filepath.Clean(path)
+
+	// Keep the current snapshot of a path that is already watched, replacing it would hide
+	// the changes made since the last poll
+	w.mu.Lock()
+	_, exists := w.watched[path]
+	w.mu.Unlock()
+	if exists {
+		return nil
+	}
+
+	state, err := w.snapshot(path)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.done:
+		return fmt.Errorf("watcher is closed")
+	default:
+	}
+	w.watched[path] = state
+	return nil
+}
+
+func (w *pollingWatcher) Remove(path string) error {
+	path = filepath.Clean(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, exists := w.watched[path]; !exists {
+		return fmt.Errorf("can't remove non-existent watch: %s", path)
+	}
+	delete(w.watched, path)
+	return nil
+}
+
+func (w *pollingWatcher) Events() <-chan fsnotify.Event {
+	return w.events
+}
+
+func (w *pollingWatcher) Errors() <-chan error {
+	return w.errors
+}
+
+func (w *pollingWatcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		<-w.stopped
+		close(w.events)
+		close(w.errors)
+	})
+	return nil
+}
+
+func (w *pollingWatcher) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, event := range w.poll() {
+				select {
+				case w.events <- event:
+				case <-w.done:
+					return
+				}
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// poll takes new snapshots of every watched path and returns the resulting events
+func (w *pollingWatcher) poll() []fsnotify.Event {
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.watched))
+	for path := range w.watched {
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+	sort.Strings(paths)
+
+	var events []fsnotify.Event
+	for _, path := range paths {
+		current, err := w.snapshot(path)
+
+		w.mu.Lock()
+		previous, watched := w.watched[path]
+		if !watched {
+			// Removed while we were polling
+			w.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			// Same as inotify, a watch does not survive the removal of its path
+			delete(w.watched, path)
+			w.mu.Unlock()
+			events = append(events, fsnotify.Event{Name: path, Op: fsnotify.Remove})
+			continue
+		}
+		w.watched[path] = current
+		w.mu.Unlock()
+
+		events = append(events, diffSnapshots(path, previous, current)...)
+	}
+	return events
+}
+
+// diffSnapshots translates the differences between two snapshots into fsnotify events
+func diffSnapshots(path string, previous, current *pollState) []fsnotify.Event {
+	if !current.self.isDir {
+		if previous.self != current.self {
+			return []fsnotify.Event{{Name: path, Op: fsnotify.Write}}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(previous.entries)+len(current.entries))
+	for name := range current.entries {
+		names = append(names, name)
+	}
+	for name := range previous.entries {
+		if _, exists := current.entries[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var events []fsnotify.Event
+	for _, name := range names {
+		entryPath := filepath.Join(path, name)
+		before, existed := previous.entries[name]
+		after, exists := current.entries[name]
+		switch {
+		case !existed:
+			events = append(events, fsnotify.Event{Name: entryPath, Op: fsnotify.Create})
+		case !exists:
+			events = append(events, fsnotify.Event{Name: entryPath, Op: fsnotify.Remove})
+		case before == after:
+		case after.isDir:
+			// A directory entry that resolves to a different directory was replaced, which
+			// is how the swap of a symlink such as ..data shows up when polling
+			events = append(events, fsnotify.Event{Name: entryPath, Op: fsnotify.Create})
+		default:
+			events = append(events, fsnotify.Event{Name: entryPath, Op: fsnotify.Write})
+		}
+	}
+	return events
+}
+
+func (w *pollingWatcher) snapshot(path string) (*pollState, error) {
+	self, err := w.snapshotFile(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &pollState{self: self}
+	if !self.isDir {
+		return state, nil
+	}
+
+	entries, err := w.reader.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	state.entries = make(map[string]fileSnapshot, len(entries))
+	for _, entry := range entries {
+		entrySnapshot, err := w.snapshotFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			// Gone between listing and reading, it will show up as created once it is back
+			continue
+		}
+		state.entries[entry.Name()] = entrySnapshot
+	}
+	return state, nil
+}
+
+func (w *pollingWatcher) snapshotFile(path string) (fileSnapshot, error) {
+	info, err := w.reader.Stat(path)
+	if err != nil {
+		return fileSnapshot{}, err
+	}
+	snapshot := fileSnapshot{
+		isDir:   info.IsDir(),
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	if info.IsDir() || info.Mode()&fs.ModeType != 0 {
+		return snapshot, nil
+	}
+
+	hash, err := hashFile(w.reader, path)
+	if err != nil && !os.IsPermission(err) {
+		return fileSnapshot{}, err
+	}
+	snapshot.hash = hash
+	return snapshot, nil
+}
+
+// hashFile hashes the content of a file, streaming it when the reader is a FileOpener so
+// that large files are not read into memory
+func hashFile(reader FileReader, path string) ([sha256.Size]byte, error) {
+	opener, ok := reader.(FileOpener)
+	if !ok {
+		content, err := reader.ReadFile(path)
+		return sha256.Sum256(content), err
+	}
+
+	var sum [sha256.Size]byte
+	file, err := opener.Open(path)
+	if err != nil {
+		return sha256.Sum256(nil), err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return sum, err
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
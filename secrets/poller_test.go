@@ -0,0 +1,134 @@
+package secrets_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func receiveEvent(t *testing.T, events <-chan fsnotify.Event) fsnotify.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for watcher event")
+	}
+	return fsnotify.Event{}
+}
+
+func TestPollingWatcher_Events(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+
+	watcher, err := secrets.NewPollingWatcherFactory(mfs, 10*time.Millisecond).NewFileWatcher()
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	require.NoError(t, watcher.Add("/mnt/secrets_store"))
+	require.NoError(t, watcher.Add("/mnt/secrets_store/token"))
+
+	// A content change is reported for the directory entry and for the watched file itself
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	events := []fsnotify.Event{receiveEvent(t, watcher.Events()), receiveEvent(t, watcher.Events())}
+	assert.ElementsMatch(t, []fsnotify.Event{
+		{Name: "/mnt/secrets_store/token", Op: fsnotify.Write},
+		{Name: "/mnt/secrets_store/token", Op: fsnotify.Write},
+	}, events)
+
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("key"))
+	assert.Equal(t, fsnotify.Event{Name: "/mnt/secrets_store/api-key", Op: fsnotify.Create}, receiveEvent(t, watcher.Events()))
+
+	mfs.RemoveFile("/mnt/secrets_store/api-key")
+	assert.Equal(t, fsnotify.Event{Name: "/mnt/secrets_store/api-key", Op: fsnotify.Remove}, receiveEvent(t, watcher.Events()))
+
+	select {
+	case event := <-watcher.Events():
+		t.Fatalf("unexpected event without changes: %s", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, watcher.Close())
+	_, isOpen := <-watcher.Events()
+	assert.False(t, isOpen)
+}
+
+func TestPollingWatcher_SameSizeRewriteIsDetected(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("aaaa"))
+
+	watcher, err := secrets.NewPollingWatcherFactory(mfs, 10*time.Millisecond).NewFileWatcher()
+	require.NoError(t, err)
+	defer watcher.Close()
+	require.NoError(t, watcher.Add("/mnt/secrets_store/token"))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("bbbb"))
+	assert.Equal(t, fsnotify.Event{Name: "/mnt/secrets_store/token", Op: fsnotify.Write}, receiveEvent(t, watcher.Events()))
+}
+
+func TestSecretLoader_PollingWatcher(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+
+	loader, err := secrets.NewFileSecretLoader(
+		context.Background(),
+		secrets.WithBasePath("/mnt/secrets_store"),
+		secrets.WithFileReader(mfs),
+		secrets.WithPollingWatcher(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer loader.Close()
+
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v2", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+}
+
+func TestSecretLoader_AutoWatcher(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("v1"), 0o644))
+
+	loader, err := secrets.NewFileSecretLoader(
+		context.Background(),
+		secrets.WithBasePath(dir),
+		secrets.WithAutoWatcher(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer loader.Close()
+
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("v2"), 0o644))
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v2", value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+}
@@ -0,0 +1,150 @@
+package secrets
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultWatcherBackoff    = 100 * time.Millisecond
+	defaultWatcherMaxBackoff = 30 * time.Second
+	// minWatcherBackoff keeps a zero or negative backoff from rebuilding in a busy loop
+	minWatcherBackoff = time.Millisecond
+)
+
+// LoaderStatus describes the health of the file watcher behind a secret loader
+type LoaderStatus struct {
+	// Healthy is false while a failed file watcher is being rebuilt. Changes made in the
+	// meantime are picked up by a full rescan once the watcher is back.
+	Healthy bool
+	// DegradedSince is when the current degraded period started, zero while healthy
+	DegradedSince time.Time
+	// LastError is the failure that caused the current or the most recent degraded period
+	LastError error
+	// Recoveries counts how many times the file watcher was rebuilt
+	Recoveries int
+}
+
+// backoffPolicy is the exponential backoff used between attempts to rebuild the watcher
+type backoffPolicy struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+func (b backoffPolicy) next(current time.Duration) time.Duration {
+	if current <= 0 {
+		return b.initial
+	}
+	current *= 2
+	if current > b.max {
+		return b.max
+	}
+	return current
+}
+
+func (fsl *fileSecretLoader) Status() LoaderStatus {
+	return fsl.status.Get()
+}
+
+// recoverWatcher replaces a failed watcher with a new one from the factory, retrying with
+// exponential backoff. It returns false when the loader was closed in the meantime.
+func (fsl *fileSecretLoader) recoverWatcher(failure error) bool {
+	if !fsl.setErrorUnlessClosed(fmt.Errorf("%w: %w", ErrWatcherFailed, failure)) {
+		return false
+	}
+	fsl.status.Set(LoaderStatus{
+		DegradedSince: time.Now(),
+		LastError:     failure,
+		Recoveries:    fsl.status.Get().Recoveries,
+	})
+
+	if err := fsl.watcher.Get().Close(); err != nil {
+		fsl.setErrorUnlessClosed(fmt.Errorf("failed to close failed watcher: %w", err))
+	}
+
+	var backoff time.Duration
+	for {
+		err := fsl.rebuildWatcher()
+		if err == nil {
+			break
+		}
+		if !fsl.setErrorUnlessClosed(fmt.Errorf("%w: failed to rebuild: %w", ErrWatcherFailed, err)) {
+			return false
+		}
+
+		backoff = fsl.backoff.next(backoff)
+		select {
+		case <-time.After(backoff):
+		case <-fsl.ctx.Done():
+			return false
+		}
+	}
+
+	// Catch up with the changes that happened while nothing was watched
+	fsl.rescan()
+	fsl.signalChange()
+
+	// Close records why the loader was closed under watcherMu, which must not be undone
+	fsl.watcherMu.Lock()
+	defer fsl.watcherMu.Unlock()
+	if fsl.isClosed.Get() {
+		return false
+	}
+	status := fsl.status.Get()
+	fsl.status.Set(LoaderStatus{
+		Healthy:    true,
+		LastError:  status.LastError,
+		Recoveries: status.Recoveries + 1,
+	})
+	fsl.setError(nil)
+	return true
+}
+
+// setErrorUnlessClosed records an error of the watcher unless the loader was closed, in
+// which case Err keeps the reason it was closed. It returns false once the loader is closed.
+func (fsl *fileSecretLoader) setErrorUnlessClosed(err error) bool {
+	fsl.watcherMu.Lock()
+	defer fsl.watcherMu.Unlock()
+	if fsl.isClosed.Get() {
+		return false
+	}
+	fsl.setError(err)
+	return true
+}
+
+// rebuildWatcher creates a new watcher and adds every path that was watched before
+func (fsl *fileSecretLoader) rebuildWatcher() error {
+	fsl.watcherMu.Lock()
+	defer fsl.watcherMu.Unlock()
+
+	if fsl.isClosed.Get() {
+		return ErrLoaderClosed
+	}
+
+	watcher, err := fsl.watcherFactory.NewFileWatcher()
+	if err != nil {
+		return err
+	}
+	fsl.watcher.Set(watcher)
+
+	for dir := range fsl.watchedDirs.CopyMap() {
+		fsl.watchedDirs.Del(dir)
+	}
+	if err := fsl.watchTree(filepath.Clean(fsl.basePath)); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+
+	for _, fs := range fsl.secrets.CopyMap() {
+		fs.attachWatcher(watcher)
+	}
+	return nil
+}
+
+// rescan re-reads every loaded secret
+func (fsl *fileSecretLoader) rescan() {
+	for _, fs := range fsl.secrets.CopyMap() {
+		fs.handleFileChange(CauseRecovered)
+	}
+}
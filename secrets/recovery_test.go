@@ -0,0 +1,149 @@
+package secrets_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func TestSecretLoader_RecoversFromWatcherErrors(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithWatcherBackoff(5*time.Millisecond, 20*time.Millisecond))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	assert.True(t, loader.Status().Healthy)
+	failed := mwf.GetWatcher()
+
+	// The event for this change was lost in the overflow, only the rescan can pick it up
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+
+	// The first rebuild attempts fail, the loader keeps retrying instead of closing
+	mwf.FailNext(2)
+	failed.SimulateError(errors.New("inotify queue overflow"))
+
+	select {
+	case value, ok := <-changes:
+		require.True(t, ok, "the secret must survive watcher failures")
+		assert.Equal(t, "v2", value)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for rescan after recovery")
+	}
+
+	require.Eventually(t, func() bool { return loader.Status().Healthy }, time.Second, 5*time.Millisecond)
+	status := loader.Status()
+	assert.Equal(t, 1, status.Recoveries)
+	assert.EqualError(t, status.LastError, "inotify queue overflow")
+	assert.True(t, status.DegradedSince.IsZero())
+
+	// Every path is watched again by the new watcher
+	rebuilt := mwf.GetWatcher()
+	assert.NotSame(t, failed, rebuilt)
+	assert.True(t, failed.IsClosed())
+	assert.True(t, rebuilt.IsWatched("/mnt/secrets_store"))
+	assert.True(t, rebuilt.IsWatched("/mnt/secrets_store/token"))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v3"))
+	rebuilt.SimulateWrite("/mnt/secrets_store/token")
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v3", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+}
+
+func TestSecretLoader_ReportsDegradedPeriod(t *testing.T) {
+	loader, _, mwf := newMockLoader(t, secrets.WithWatcherBackoff(time.Hour, time.Hour))
+
+	mwf.FailNext(1)
+	mwf.GetWatcher().SimulateError(errors.New("watch limit reached"))
+
+	require.Eventually(t, func() bool { return !loader.Status().Healthy }, time.Second, 5*time.Millisecond)
+	status := loader.Status()
+	assert.False(t, status.DegradedSince.IsZero())
+	assert.EqualError(t, status.LastError, "watch limit reached")
+
+	// Still usable while degraded
+	_, err := loader.ListSecretKeys()
+	assert.NoError(t, err)
+
+	// Closing while waiting for the next attempt does not hang
+	done := make(chan struct{})
+	go func() {
+		loader.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout closing degraded loader")
+	}
+}
+
+func TestSecretLoader_ClampsWatcherBackoff(t *testing.T) {
+	loader, _, mwf := newMockLoader(t, secrets.WithWatcherBackoff(0, -time.Second))
+
+	mwf.FailNext(1 << 30)
+	mwf.GetWatcher().SimulateError(errors.New("inotify queue overflow"))
+	require.Eventually(t, func() bool { return !loader.Status().Healthy }, time.Second, time.Millisecond)
+
+	// A zero backoff is raised to the minimum instead of rebuilding in a busy loop
+	time.Sleep(50 * time.Millisecond)
+	assert.Less(t, mwf.Attempts(), 200)
+	mwf.FailNext(0)
+}
+
+// closingWatcherFactory closes the loader while it rebuilds the watcher
+type closingWatcherFactory struct {
+	*mocks.MockWatcherFactory
+	onRebuild func()
+	calls     int
+}
+
+func (f *closingWatcherFactory) NewFileWatcher() (secrets.FileWatcher, error) {
+	f.calls++
+	if f.calls > 1 {
+		f.onRebuild()
+	}
+	return f.MockWatcherFactory.NewFileWatcher()
+}
+
+func TestSecretLoader_CloseDuringRecoveryKeepsReason(t *testing.T) {
+	factory := &closingWatcherFactory{MockWatcherFactory: mocks.NewMockWatcherFactory()}
+	loader, mfs, _ := newMockLoader(t, secrets.WithWatcherFactory(factory))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	factory.onRebuild = func() {
+		go loader.Close()
+		// The secrets are closed right before Close records its reason
+		for range changes {
+		}
+	}
+	factory.GetWatcher().SimulateError(errors.New("inotify queue overflow"))
+
+	select {
+	case <-loader.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the loader to close")
+	}
+	assert.Never(t, func() bool {
+		return !errors.Is(loader.Err(), secrets.ErrLoaderClosed)
+	}, 100*time.Millisecond, time.Millisecond)
+	assert.False(t, loader.Status().Healthy)
+}
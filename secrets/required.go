@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RequiredSecretsError lists every required secret that could not be loaded at startup
+type RequiredSecretsError struct {
+	Missing    []string
+	Empty      []string
+	Unreadable map[string]error
+	// Invalid holds the secrets whose value was rejected by a validator
+	Invalid map[string]error
+}
+
+func (e *RequiredSecretsError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Empty) > 0 {
+		problems = append(problems, "empty: "+strings.Join(e.Empty, ", "))
+	}
+	if len(e.Unreadable) > 0 {
+		unreadable := make([]string, 0, len(e.Unreadable))
+		for _, key := range sortedKeys(e.Unreadable) {
+			unreadable = append(unreadable, fmt.Sprintf("%s (%v)", key, e.Unreadable[key]))
+		}
+		problems = append(problems, "unreadable: "+strings.Join(unreadable, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		invalid := make([]string, 0, len(e.Invalid))
+		for _, key := range sortedKeys(e.Invalid) {
+			invalid = append(invalid, fmt.Sprintf("%s (%v)", key, e.Invalid[key]))
+		}
+		problems = append(problems, "invalid: "+strings.Join(invalid, ", "))
+	}
+	return "required secrets are not available: " + strings.Join(problems, "; ")
+}
+
+func (e *RequiredSecretsError) hasProblems() bool {
+	return len(e.Missing) > 0 || len(e.Empty) > 0 || len(e.Unreadable) > 0 || len(e.Invalid) > 0
+}
+
+// add classifies the outcome of loading a single required secret
+func (e *RequiredSecretsError) add(key string, secret Secret, err error) {
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		e.Missing = append(e.Missing, key)
+	case errors.Is(err, ErrSecretEmpty):
+		e.Empty = append(e.Empty, key)
+	case errors.Is(err, ErrValidationFailed):
+		if e.Invalid == nil {
+			e.Invalid = make(map[string]error)
+		}
+		e.Invalid[key] = err
+	case err != nil:
+		if e.Unreadable == nil {
+			e.Unreadable = make(map[string]error)
+		}
+		e.Unreadable[key] = err
+	case secret.Value() == "":
+		e.Empty = append(e.Empty, key)
+	}
+}
+
+// WithRequiredSecrets makes NewFileSecretLoader load every given key eagerly. The loader is
+// only returned when all of them exist, are readable and are not empty, otherwise a
+// *RequiredSecretsError lists all the keys that are not.
+func WithRequiredSecrets(keys ...string) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.required = append(fsl.required, keys...)
+	}
+}
+
+// preloadRequired loads all required secrets and aggregates the failures
+func (fsl *fileSecretLoader) preloadRequired() error {
+	result := &RequiredSecretsError{}
+	for _, key := range fsl.required {
+		secret, err := fsl.GetSecret(key)
+		result.add(key, secret, err)
+	}
+	if result.hasProblems() {
+		return result
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,79 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+// unreadableReader fails to read a single path
+type unreadableReader struct {
+	secrets.FileReader
+	path string
+}
+
+func (r *unreadableReader) ReadFile(path string) ([]byte, error) {
+	if path == r.path {
+		return nil, errors.New("permission denied")
+	}
+	return r.FileReader.ReadFile(path)
+}
+
+func TestNewFileSecretLoader_RequiredSecrets(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	defer mfs.Close()
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("key"))
+	mfs.WriteFile("/mnt/secrets_store/db/password", []byte("password"))
+	mfs.WriteFile("/mnt/secrets_store/empty", []byte(""))
+	mfs.WriteFile("/mnt/secrets_store/locked", []byte("locked"))
+
+	newLoader := func(required ...string) (secrets.SecretLoader, error) {
+		return secrets.NewFileSecretLoader(
+			context.Background(),
+			secrets.WithBasePath("/mnt/secrets_store"),
+			secrets.WithFileReader(&unreadableReader{FileReader: mfs, path: "/mnt/secrets_store/locked"}),
+			secrets.WithWatcherFactory(mocks.NewMockWatcherFactory()),
+			secrets.WithRequiredSecrets(required...),
+		)
+	}
+
+	t.Run("all required secrets available", func(t *testing.T) {
+		loader, err := newLoader("api-key", "db/password")
+		require.NoError(t, err)
+		defer loader.Close()
+
+		secret, err := loader.GetSecret("db/password")
+		require.NoError(t, err)
+		assert.Equal(t, "password", secret.Value())
+	})
+
+	t.Run("every problem is reported at once", func(t *testing.T) {
+		loader, err := newLoader("api-key", "missing-a", "empty", "locked", "db/missing-b")
+		require.Error(t, err)
+		assert.Nil(t, loader)
+
+		var requiredErr *secrets.RequiredSecretsError
+		require.ErrorAs(t, err, &requiredErr)
+		assert.Equal(t, []string{"missing-a", "db/missing-b"}, requiredErr.Missing)
+		assert.Equal(t, []string{"empty"}, requiredErr.Empty)
+		require.Contains(t, requiredErr.Unreadable, "locked")
+		assert.ErrorContains(t, requiredErr.Unreadable["locked"], "permission denied")
+
+		assert.Contains(t, err.Error(), "missing: missing-a, db/missing-b")
+		assert.Contains(t, err.Error(), "empty: empty")
+		assert.Contains(t, err.Error(), "unreadable: locked")
+	})
+}
+
+func TestSecretLoader_GetSecretNotFound(t *testing.T) {
+	loader, _, _ := newMockLoader(t)
+
+	_, err := loader.GetSecret("missing")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+}
@@ -0,0 +1,149 @@
+package secrets_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func newMockLoader(t *testing.T, opts ...secrets.Option) (secrets.SecretLoader, *mocks.MockFileSystem, *mocks.MockWatcherFactory) {
+	t.Helper()
+
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.CreateDir("/mnt/secrets_store")
+
+	mwf := mocks.NewMockWatcherFactory()
+
+	opts = append([]secrets.Option{
+		secrets.WithBasePath("/mnt/secrets_store"),
+		secrets.WithFileReader(mfs),
+		secrets.WithWatcherFactory(mwf),
+	}, opts...)
+
+	loader, err := secrets.NewFileSecretLoader(context.Background(), opts...)
+	require.NoError(t, err)
+	t.Cleanup(loader.Close)
+
+	return loader, mfs, mwf
+}
+
+func TestSecretLoader_EventRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    []string
+		changed string
+	}{
+		{
+			name:    "keys that are prefixes or substrings of each other",
+			keys:    []string{"api", "api-key", "key", "i-k"},
+			changed: "api-key",
+		},
+		{
+			name:    "shorter key is not reloaded by a longer one",
+			keys:    []string{"api", "api-key", "key"},
+			changed: "api",
+		},
+		{
+			name:    "keys containing the event op text",
+			keys:    []string{"WRITE", "CREATE", "token"},
+			changed: "token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader, mfs, mwf := newMockLoader(t)
+
+			channels := map[string]<-chan string{}
+			for _, key := range tt.keys {
+				mfs.WriteFile("/mnt/secrets_store/"+key, []byte("initial"))
+				secret, err := loader.GetSecret(key)
+				require.NoError(t, err)
+				channels[key], err = secret.ListenChanges()
+				require.NoError(t, err)
+			}
+
+			for _, key := range tt.keys {
+				mfs.WriteFile("/mnt/secrets_store/"+key, []byte("rotated"))
+			}
+			mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/"+tt.changed, fsnotify.Write)
+
+			select {
+			case value := <-channels[tt.changed]:
+				assert.Equal(t, "rotated", value)
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for secret change notification")
+			}
+
+			for key, ch := range channels {
+				if key == tt.changed {
+					continue
+				}
+				select {
+				case value := <-ch:
+					t.Errorf("secret %s reloaded by event for %s: %s", key, tt.changed, value)
+				default:
+				}
+			}
+		})
+	}
+}
+
+func TestSecretLoader_EventRoutingManySecrets(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+
+	const numSecrets = 5000
+	secretsByKey := make(map[string]secrets.Secret, numSecrets)
+	for i := 0; i < numSecrets; i++ {
+		key := fmt.Sprintf("secret-%d", i)
+		mfs.WriteFile("/mnt/secrets_store/"+key, []byte("initial"))
+		secret, err := loader.GetSecret(key)
+		require.NoError(t, err)
+		secretsByKey[key] = secret
+	}
+
+	changes, err := secretsByKey["secret-42"].ListenChanges()
+	require.NoError(t, err)
+
+	for key := range secretsByKey {
+		mfs.WriteFile("/mnt/secrets_store/"+key, []byte("rotated"))
+	}
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/secret-42", fsnotify.Write)
+
+	select {
+	case value := <-changes:
+		assert.Equal(t, "rotated", value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+
+	// secret-4, secret-420 and friends share a prefix but must keep their value
+	for _, key := range []string{"secret-4", "secret-420", "secret-4200"} {
+		assert.Equal(t, "initial", secretsByKey[key].Value(), key)
+	}
+}
+
+func TestSecretLoader_GetSecretNormalizesKeys(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("value"))
+
+	first, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	second, err := loader.GetSecret("./token")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	for _, key := range []string{"../token", "/etc/passwd", ".", "a/../../token"} {
+		_, err := loader.GetSecret(key)
+		assert.Error(t, err, key)
+	}
+}
@@ -1,9 +1,13 @@
 package secrets
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
@@ -13,11 +17,29 @@ type fileSecret struct {
 	id             string
 	path           string
 	value          ConcurrentValue[string]
-	subscribers    ConcurrentList[subscriberInfo]
+	version        atomic.Uint64
+	history        *versionHistory
+	config         secretConfig
+	configMu       sync.Mutex
+	validators     ConcurrentValue[[]Validator]
+	maxSize        ConcurrentValue[int64]
+	field          projection
+	subscribers    ConcurrentList[listener]
+	statusSubs     ConcurrentList[chan SecretStatus]
+	statusMu       sync.Mutex
+	staleSince     ConcurrentValue[time.Time]
 	watcher        ConcurrentValue[FileWatcher]
-	watchOnce      sync.Once
+	watchMu        sync.Mutex
+	watched        ConcurrentValue[bool]
+	reloadMu       sync.Mutex
+	settleWindow   time.Duration
+	settleMu       sync.Mutex
+	settleTimer    *time.Timer
+	settling       []byte
+	rejectEmpty    bool
 	closed         ConcurrentValue[bool]
 	closeOnce      sync.Once
+	done           chan struct{}
 	ctx            context.Context
 	err            ConcurrentValue[error]
 	reader         FileReader
@@ -28,33 +50,142 @@ func (fs *fileSecret) Value() string {
 	return fs.value.Get()
 }
 
-func (fs *fileSecret) ListenChanges() (<-chan string, error) {
+// StaleSince returns the time at which the secret file went missing. While it is missing,
+// Value keeps returning the last value that was read successfully.
+func (fs *fileSecret) StaleSince() (time.Time, bool) {
+	since := fs.staleSince.Get()
+	return since, !since.IsZero()
+}
+
+func (fs *fileSecret) ListenStatus() (<-chan SecretStatus, error) {
+	fs.statusMu.Lock()
+	defer fs.statusMu.Unlock()
 
 	if fs.closed.Get() {
-		return nil, fmt.Errorf("secret %s is closed", fs.id)
+		return nil, fmt.Errorf("%w: %s", ErrSecretClosed, fs.id)
 	}
 
-	var err error
-	// Start watching on first subscriber (lazy initialization)
-	fs.watchOnce.Do(func() {
-		w := fs.watcher.Get()
-		if w == nil {
-			err = fmt.Errorf("file watcher is not initialized")
-		} else {
-			err = w.Add(fs.path)
+	// Status is a state rather than a stream, so a single slot holding the latest one is enough
+	ch := make(chan SecretStatus, 1)
+	fs.statusSubs.Add(ch)
+	return ch, nil
+}
+
+// ListenStatusContext is like ListenStatus, but the channel is removed and closed as soon
+// as ctx ends
+func (fs *fileSecret) ListenStatusContext(ctx context.Context) (<-chan SecretStatus, error) {
+	ch, err := fs.ListenStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			fs.unsubscribeStatus(ch)
+		case <-fs.done:
+		}
+	}()
+
+	return ch, nil
+}
+
+// unsubscribeStatus removes a status channel and closes it, unless Close already did
+func (fs *fileSecret) unsubscribeStatus(ch <-chan SecretStatus) {
+	fs.statusMu.Lock()
+	defer fs.statusMu.Unlock()
+
+	fs.statusSubs.RemoveFunc(func(sub chan SecretStatus) bool {
+		if sub != ch {
+			return false
 		}
+		close(sub)
+		return true
 	})
+}
+
+func (fs *fileSecret) ListenChanges() (<-chan string, error) {
+	subscription, err := fs.Subscribe()
 	if err != nil {
-		return nil, fmt.Errorf("failed to start watching secret %s: %w", fs.id, err)
+		return nil, err
 	}
+	return subscription.Changes(), nil
+}
 
-	// Create buffered channel for this subscriber
-	ch := make(chan string, 1)
-	fs.subscribers.Add(subscriberInfo{
-		ch: ch,
+func (fs *fileSecret) Subscribe(opts ...SubscribeOption) (*Subscription[string], error) {
+	return subscribe(fs, opts, func(change valueChange) string {
+		return change.newValue
 	})
+}
 
-	return ch, nil
+// ListenChangesContext is like ListenChanges, but the subscriber is removed and its channel
+// closed as soon as ctx ends
+func (fs *fileSecret) ListenChangesContext(ctx context.Context) (<-chan string, error) {
+	subscription, err := fs.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			subscription.Unsubscribe()
+		case <-subscription.sub.gone:
+		}
+	}()
+
+	return subscription.Changes(), nil
+}
+
+// addListener starts watching the secret file if needed and registers the listener
+func (fs *fileSecret) addListener(l listener) error {
+	fs.watchMu.Lock()
+	defer fs.watchMu.Unlock()
+
+	if fs.closed.Get() {
+		return fmt.Errorf("%w: %s", ErrSecretClosed, fs.id)
+	}
+
+	// Start watching on first subscriber (lazy initialization). Fields rely on the watch of
+	// the directory, so that unsubscribing from a field does not end the watch of the file
+	// shared with the document and its other fields.
+	if !fs.watched.Get() && fs.field == nil {
+		w := fs.watcher.Get()
+		if w == nil {
+			return fmt.Errorf("failed to start watching secret %s: file watcher is not initialized", fs.id)
+		}
+		if err := w.Add(fs.path); err != nil {
+			return fmt.Errorf("failed to start watching secret %s: %w", fs.id, err)
+		}
+		fs.watched.Set(true)
+	}
+
+	fs.subscribers.Add(l)
+	return nil
+}
+
+// removeListeners unregisters the listeners and stops watching the secret file once the
+// last one is gone
+func (fs *fileSecret) removeListeners(remove func(listener) bool) {
+	fs.watchMu.Lock()
+	defer fs.watchMu.Unlock()
+
+	fs.subscribers.RemoveFunc(remove)
+	if len(fs.subscribers.Get()) > 0 || !fs.watched.Get() {
+		return
+	}
+
+	fs.watched.Set(false)
+	if w := fs.watcher.Get(); w != nil {
+		// The watch may already be gone together with a deleted file
+		_ = w.Remove(fs.path)
+	}
+}
+
+// unsubscribe removes a single listener and closes it
+func (fs *fileSecret) unsubscribe(l listener) {
+	fs.removeListeners(func(other listener) bool { return other == l })
+	l.close()
 }
 
 func (fs *fileSecret) getFileEvents() <-chan fsnotify.Event {
@@ -86,43 +217,269 @@ func (fs *fileSecret) addWatchPath() error {
 	return watcher.Add(fs.path)
 }
 
-// handleFileChange reads the new file content and broadcasts to subscribers
-func (fs *fileSecret) handleFileChange() {
+// rewatch re-adds the secret path to the watcher so the watch follows the file that the
+// path currently resolves to. It is a no-op when nobody has subscribed yet.
+func (fs *fileSecret) rewatch() {
+	if !fs.watched.Get() {
+		return
+	}
+	watcher := fs.watcher.Get()
+	if watcher == nil {
+		return
+	}
+	// The previous inode may already be gone, in which case the watcher dropped it itself
+	_ = watcher.Remove(fs.path)
+	fs.addWatch(watcher)
+}
+
+// addWatch adds the secret path to the watcher again. A failure is reported by Err until a
+// later attempt succeeds. A missing file is watched again once it is recreated, see
+// markPresent.
+func (fs *fileSecret) addWatch(watcher FileWatcher) {
+	if err := watcher.Add(fs.path); err != nil && !os.IsNotExist(err) {
+		fs.err.Set(fmt.Errorf("%w: failed to re-watch secret %s: %w", ErrWatcherFailed, fs.id, err))
+		return
+	}
+	fs.clearError(ErrWatcherFailed)
+}
+
+// scheduleReload reloads the secret once the file has been quiet for the settle window.
+// Every new event restarts the window, so a burst of writes results in a single reload.
+func (fs *fileSecret) scheduleReload() {
+	if fs.settleWindow <= 0 {
+		fs.handleFileChange(CauseRotation)
+		return
+	}
+
+	fs.settleMu.Lock()
+	defer fs.settleMu.Unlock()
+	if fs.settleTimer == nil {
+		fs.settleTimer = time.AfterFunc(fs.settleWindow, fs.handleSettledChange)
+		return
+	}
+	fs.settleTimer.Reset(fs.settleWindow)
+}
+
+// handleSettledChange only publishes content that did not change across two reads one
+// settle window apart, otherwise it reads again after another window
+func (fs *fileSecret) handleSettledChange() {
+	fs.reloadMu.Lock()
+	defer fs.reloadMu.Unlock()
+
+	if fs.closed.Get() {
+		return
+	}
+
+	content, err := readSecretFile(fs.reader, fs.path, fs.maxSize.Get())
+	if err == nil {
+		fs.settleMu.Lock()
+		stable := fs.settling != nil && bytes.Equal(fs.settling, content)
+		if stable {
+			fs.settling = nil
+		} else {
+			fs.settling = content
+			fs.settleTimer.Reset(fs.settleWindow)
+		}
+		fs.settleMu.Unlock()
+
+		if !stable {
+			return
+		}
+	}
+
+	fs.applyContent(content, err, CauseRotation)
+}
+
+// attachWatcher switches the secret over to a rebuilt watcher
+func (fs *fileSecret) attachWatcher(watcher FileWatcher) {
+	fs.watcher.Set(watcher)
+	if !fs.watched.Get() {
+		// Nothing to watch, so an earlier watch failure does not matter anymore
+		fs.clearError(ErrWatcherFailed)
+		return
+	}
+	fs.addWatch(watcher)
+}
+
+// handleFileChange reads the new file content and broadcasts to subscribers.
+// Calls are serialized so that concurrent triggers for the same content publish it once.
+func (fs *fileSecret) handleFileChange(cause ChangeCause) {
+	fs.reloadMu.Lock()
+	defer fs.reloadMu.Unlock()
+
+	if fs.closed.Get() {
+		return
+	}
+
 	// Read new content
-	content, err := fs.reader.ReadFile(fs.path)
+	content, err := readSecretFile(fs.reader, fs.path, fs.maxSize.Get())
+	fs.applyContent(content, err, cause)
+}
+
+// applyContent publishes the outcome of reading the secret file, reloadMu must be held
+func (fs *fileSecret) applyContent(content []byte, err error, cause ChangeCause) {
 	if err != nil {
-		fs.Close()
+		if os.IsNotExist(err) {
+			fs.markMissing()
+			return
+		}
+		// Keep serving the last good value, the next event retries the read
+		fs.err.Set(fmt.Errorf("%w %s: %w", ErrReadFailed, fs.path, err))
 		return
 	}
+	fs.clearError(ErrReadFailed)
+
+	if fs.rejectEmpty && len(content) == 0 {
+		// Most likely truncated by a writer that did not write the new content yet
+		return
+	}
+
+	if fs.markPresent() {
+		// The watch on the deleted file was dropped together with its inode
+		fs.rewatch()
+		cause = CauseRecreated
+	}
+
+	if fs.field != nil {
+		projected, err := fs.field.project(fs.id, content)
+		if err != nil {
+			// Most likely a document that is being rewritten, keep the last good value
+			fs.err.Set(err)
+			return
+		}
+		fs.clearError(ErrDecodeFailed)
+		fs.clearError(ErrFieldNotFound)
+		content = projected
+	}
 
 	newValue := string(content)
+	oldValue := fs.value.Get()
 
-	if newValue == fs.value.Get() {
+	if newValue == oldValue {
+		// Also back to the last good value after a rejected one
+		fs.clearError(ErrValidationFailed)
 		return // No change, skip broadcasting
 	}
 
+	if err := validate(fs.validators.Get(), fs.id, newValue); err != nil {
+		// Keep serving the last good value, the next event validates again
+		fs.err.Set(err)
+		return
+	}
+	fs.clearError(ErrValidationFailed)
+
 	// Update cached value
 	fs.value.Set(newValue)
+	version := fs.version.Add(1)
+	detectedAt := time.Now()
+	fs.history.record(newValue, version, detectedAt)
+
+	change := valueChange{
+		oldValue:   oldValue,
+		newValue:   newValue,
+		version:    version,
+		detectedAt: detectedAt,
+		cause:      cause,
+		content:    content,
+	}
+	if info, err := fs.reader.Stat(fs.path); err == nil {
+		change.modTime = info.ModTime()
+	}
+	fs.publish(change)
+}
 
-	// Broadcast to all subscribers with failure tracking
-	subscribers := fs.subscribers.Get()
-	activeSubscribers := make([]subscriberInfo, 0, len(subscribers))
-	for _, sub := range subscribers {
+// publish notifies every listener and removes the ones that gave up
+func (fs *fileSecret) publish(change valueChange) {
+	removed := make(map[listener]bool)
+	for _, l := range fs.subscribers.Get() {
+		if !l.notify(change) {
+			removed[l] = true
+		}
+	}
+	if len(removed) > 0 {
+		fs.removeListeners(func(l listener) bool { return removed[l] })
+	}
+}
+
+// markMissing records that the secret file disappeared and tells status subscribers
+func (fs *fileSecret) markMissing() {
+	if _, stale := fs.StaleSince(); stale {
+		return
+	}
+	since := time.Now()
+	fs.staleSince.Set(since)
+	fs.publishStatus(SecretStatus{Key: fs.id, Missing: true, StaleSince: since})
+}
+
+// markPresent clears the missing state and reports whether the file was missing before
+func (fs *fileSecret) markPresent() bool {
+	if _, stale := fs.StaleSince(); !stale {
+		return false
+	}
+	fs.staleSince.Set(time.Time{})
+	fs.publishStatus(SecretStatus{Key: fs.id})
+	return true
+}
+
+// publishStatus replaces any status a subscriber has not consumed yet with the new one
+func (fs *fileSecret) publishStatus(status SecretStatus) {
+	fs.statusMu.Lock()
+	defer fs.statusMu.Unlock()
+
+	for _, ch := range fs.statusSubs.Get() {
+		select {
+		case ch <- status:
+			continue
+		default:
+		}
+		// Drop the outdated status; the subscriber may have just consumed it
+		select {
+		case <-ch:
+		default:
+		}
 		select {
-		case sub.ch <- newValue:
-			activeSubscribers = append(activeSubscribers, sub)
+		case ch <- status:
 		default:
-			// Channel buffer is full, close and remove channel
-			close(sub.ch)
 		}
 	}
+}
+
+// configure applies the options passed to GetSecret for an already loaded secret on top of
+// its current config, so that the settings of earlier calls are kept
+func (fs *fileSecret) configure(opts []SecretOption) {
+	fs.configMu.Lock()
+	defer fs.configMu.Unlock()
+
+	for _, opt := range opts {
+		opt(&fs.config)
+	}
+	fs.history.configure(fs.config)
+	fs.validators.Set(fs.config.allValidators())
+	fs.maxSize.Set(fs.config.maxSize)
+}
+
+// Version returns the version of the current value, starting at 1 when the secret is loaded
+func (fs *fileSecret) Version() uint64 {
+	return fs.version.Load()
+}
+
+// Err returns the current error of the secret, or the reason it was closed
+func (fs *fileSecret) Err() error {
+	return fs.err.Get()
+}
 
-	// Update subscribers list (filtering out closed channels)
-	fs.subscribers.Set(activeSubscribers)
+// Done returns a channel that is closed once the secret was closed
+func (fs *fileSecret) Done() <-chan struct{} {
+	return fs.done
 }
 
 // Close stops watching and closes all subscriber channels
 func (fs *fileSecret) Close() {
+	fs.closeWithError(fmt.Errorf("%w: %s", ErrSecretClosed, fs.id))
+}
+
+// closeWithError closes the secret and records the reason, which Err returns from now on
+func (fs *fileSecret) closeWithError(reason error) {
 
 	// Already closed
 	if fs.closed.Get() {
@@ -131,13 +488,33 @@ func (fs *fileSecret) Close() {
 
 	// Ensure close logic runs only once
 	fs.closeOnce.Do(func() {
+		defer close(fs.done)
+
+		// Wait for an in-flight reload so nothing is sent on a closed channel
+		fs.reloadMu.Lock()
+		defer fs.reloadMu.Unlock()
+
 		// first avoid close the door for new subscribers
 		fs.closed.Set(true)
+		fs.err.Set(reason)
+
+		fs.settleMu.Lock()
+		if fs.settleTimer != nil {
+			fs.settleTimer.Stop()
+		}
+		fs.settleMu.Unlock()
 
 		// signal all subscribers that the secret is closed
-		for _, sub := range fs.subscribers.Get() {
-			close(sub.ch)
+		for _, l := range fs.subscribers.Get() {
+			l.close()
+		}
+		fs.subscribers.Set(nil)
+
+		fs.statusMu.Lock()
+		for _, ch := range fs.statusSubs.Get() {
+			close(ch)
 		}
-		fs.subscribers.Set([]subscriberInfo{})
+		fs.statusSubs.Set(nil)
+		fs.statusMu.Unlock()
 	})
 }
@@ -0,0 +1,90 @@
+package secrets_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+// collectValues gathers every notification received within the given duration
+func collectValues(ch <-chan string, within time.Duration) []string {
+	var values []string
+	deadline := time.After(within)
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return values
+			}
+			values = append(values, value)
+		case <-deadline:
+			return values
+		}
+	}
+}
+
+func TestSecret_SettleWindowCoalescesBursts(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithSettleWindow(30*time.Millisecond))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	// A rotation written in several syscalls
+	for _, partial := range []string{"", "v", "v2-par", "v2-complete"} {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(partial))
+		mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	assert.Equal(t, []string{"v2-complete"}, collectValues(changes, 300*time.Millisecond))
+	assert.Equal(t, "v2-complete", secret.Value())
+}
+
+func TestSecret_SettleWindowWaitsForStableContent(t *testing.T) {
+	const window = 100 * time.Millisecond
+	loader, mfs, mwf := newMockLoader(t, secrets.WithSettleWindow(window))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2-partial"))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+
+	// The rest of the content lands between the first and the second read, without an event
+	time.Sleep(window + window/2)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2-complete"))
+
+	assert.Equal(t, []string{"v2-complete"}, collectValues(changes, 5*window))
+}
+
+func TestSecret_RejectEmpty(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t, secrets.WithRejectEmpty())
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	// Truncated before being rewritten
+	mfs.WriteFile("/mnt/secrets_store/token", []byte(""))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateWrite("/mnt/secrets_store/token")
+
+	assert.Equal(t, []string{"v2"}, collectValues(changes, 100*time.Millisecond))
+
+	mfs.WriteFile("/mnt/secrets_store/empty", []byte(""))
+	_, err = loader.GetSecret("empty")
+	assert.ErrorContains(t, err, "empty")
+}
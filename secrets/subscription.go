@@ -0,0 +1,277 @@
+package secrets
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DeliveryPolicy decides what happens to a notification when the subscriber did not
+// consume the previous ones yet
+type DeliveryPolicy int
+
+const (
+	// DeliveryDisconnect closes the channel of a subscriber that is not keeping up and
+	// stops notifying it. This is the behaviour of ListenChanges.
+	DeliveryDisconnect DeliveryPolicy = iota
+	// DeliveryLatest replaces the notification waiting in the buffer with the new one
+	DeliveryLatest
+	// DeliveryDropOldest drops the oldest buffered notification to make room for the new one
+	DeliveryDropOldest
+	// DeliveryBlock queues the notifications and waits up to a timeout for the subscriber to
+	// take each of them before dropping it
+	DeliveryBlock
+)
+
+// SubscribeOption configures a subscription created by Secret.Subscribe
+type SubscribeOption func(*subscribeConfig)
+
+type subscribeConfig struct {
+	policy     DeliveryPolicy
+	bufferSize int
+	timeout    time.Duration
+}
+
+func newSubscribeConfig(opts []SubscribeOption) subscribeConfig {
+	config := subscribeConfig{policy: DeliveryDisconnect, bufferSize: 1}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.bufferSize < 1 {
+		config.bufferSize = 1
+	}
+	return config
+}
+
+// LatestValueWins replaces a notification the subscriber did not consume yet with the new one
+func LatestValueWins() SubscribeOption {
+	return func(c *subscribeConfig) {
+		c.policy = DeliveryLatest
+		c.bufferSize = 1
+	}
+}
+
+// DropOldest buffers up to bufferSize notifications and drops the oldest one when full
+func DropOldest(bufferSize int) SubscribeOption {
+	return func(c *subscribeConfig) {
+		c.policy = DeliveryDropOldest
+		c.bufferSize = bufferSize
+	}
+}
+
+// BlockWithTimeout waits up to timeout for the subscriber to make room before dropping the
+// notification. The waiting happens on a goroutine of the subscriber, so reloads are never
+// held up. Notifications are queued in order while the subscriber is busy, and each one is
+// only dropped once it waited for its own timeout.
+func BlockWithTimeout(timeout time.Duration) SubscribeOption {
+	return func(c *subscribeConfig) {
+		c.policy = DeliveryBlock
+		c.timeout = timeout
+	}
+}
+
+// Disconnect closes the channel of a subscriber that did not consume the previous
+// notification, which is the default
+func Disconnect() SubscribeOption {
+	return func(c *subscribeConfig) {
+		c.policy = DeliveryDisconnect
+		c.bufferSize = 1
+	}
+}
+
+// Subscription is a subscriber to the changes of a secret, delivered as the new value by
+// Subscribe, as the bytes that were read by SubscribeBytes, as a ChangeEvent by ListenEvents
+// and decoded by Typed.Subscribe
+type Subscription[T any] struct {
+	sub    *subscriber[T]
+	secret *fileSecret
+}
+
+// subscribe adds a subscriber that converts the changes of the secret with deliver
+func subscribe[T any](fs *fileSecret, opts []SubscribeOption, deliver func(valueChange) T) (*Subscription[T], error) {
+	sub := newSubscriber(newSubscribeConfig(opts), deliver)
+	if err := fs.addListener(sub); err != nil {
+		return nil, err
+	}
+	return &Subscription[T]{sub: sub, secret: fs}, nil
+}
+
+// Unsubscribe removes the subscriber and closes its channel. Once the last subscriber of a
+// secret is gone, its file is not watched anymore.
+func (s *Subscription[T]) Unsubscribe() {
+	s.secret.unsubscribe(s.sub)
+}
+
+// Changes returns the channel on which the changes are delivered. It is closed once the
+// secret is closed or, with DeliveryDisconnect, once the subscriber fell behind.
+func (s *Subscription[T]) Changes() <-chan T {
+	return s.sub.ch
+}
+
+// Dropped returns how many notifications were not delivered to this subscriber
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.sub.dropped.Load()
+}
+
+// valueChange is what a reload publishes to the listeners of a secret
+type valueChange struct {
+	oldValue   string
+	newValue   string
+	version    uint64
+	detectedAt time.Time
+	modTime    time.Time
+	cause      ChangeCause
+	// content is newValue as it was read, shared by the byte subscribers
+	content []byte
+}
+
+// listener receives the changes of a secret
+type listener interface {
+	// notify delivers a change and returns false once the listener must be removed
+	notify(change valueChange) bool
+	close()
+}
+
+// subscriber delivers changes on a channel according to its delivery policy
+type subscriber[T any] struct {
+	mu      sync.Mutex
+	ch      chan T
+	config  subscribeConfig
+	convert func(valueChange) T
+	dropped atomic.Uint64
+	closed  bool
+	gone    chan struct{}
+	// pending and wake feed the goroutine waiting for the subscriber with DeliveryBlock
+	pending []pendingValue[T]
+	wake    chan struct{}
+}
+
+// pendingValue is a notification queued for a subscriber with DeliveryBlock
+type pendingValue[T any] struct {
+	value    T
+	deadline time.Time
+}
+
+func newSubscriber[T any](config subscribeConfig, convert func(valueChange) T) *subscriber[T] {
+	s := &subscriber[T]{
+		ch:      make(chan T, config.bufferSize),
+		config:  config,
+		convert: convert,
+		gone:    make(chan struct{}),
+	}
+	if config.policy == DeliveryBlock {
+		s.wake = make(chan struct{}, 1)
+		go s.deliverBlocking()
+	}
+	return s
+}
+
+func (s *subscriber[T]) notify(change valueChange) bool {
+	return s.deliver(s.convert(change))
+}
+
+func (s *subscriber[T]) deliver(value T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if s.config.policy == DeliveryBlock {
+		// Handed to deliverBlocking, which keeps the notifications in order. Waiting on the
+		// reload goroutine would hold up the reloads of every secret of the loader.
+		s.pending = append(s.pending, pendingValue[T]{value: value, deadline: time.Now().Add(s.config.timeout)})
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	select {
+	case s.ch <- value:
+		return true
+	default:
+	}
+
+	switch s.config.policy {
+	case DeliveryLatest, DeliveryDropOldest:
+		// Only the subscriber receives concurrently, so after taking one value out
+		// there is room for the new one
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+		s.ch <- value
+		return true
+
+	default:
+		// Channel buffer is full, close and remove channel
+		s.dropped.Add(1)
+		s.closeLocked()
+		return false
+	}
+}
+
+func (s *subscriber[T]) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *subscriber[T]) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.gone)
+	if s.wake == nil {
+		// Otherwise deliverBlocking closes the channel once it stopped sending
+		close(s.ch)
+	}
+}
+
+// deliverBlocking sends the pending notifications, each until its deadline. They are queued
+// in order with the same timeout, so a notification has not expired while the one before it
+// is still waiting.
+func (s *subscriber[T]) deliverBlocking() {
+	defer close(s.ch)
+	for {
+		select {
+		case <-s.wake:
+		case <-s.gone:
+			return
+		}
+
+		for {
+			s.mu.Lock()
+			if s.closed || len(s.pending) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			next := s.pending[0]
+			s.pending[0] = pendingValue[T]{}
+			s.pending = s.pending[1:]
+			s.mu.Unlock()
+
+			select {
+			case s.ch <- next.value:
+				continue
+			default:
+			}
+
+			timer := time.NewTimer(time.Until(next.deadline))
+			select {
+			case s.ch <- next.value:
+			case <-timer.C:
+				s.dropped.Add(1)
+			case <-s.gone:
+				timer.Stop()
+				return
+			}
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package secrets_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+// rotate writes count new values and waits until the secret has seen the last one
+func rotate(t *testing.T, secret secrets.Secret, write func(value string), count int) {
+	t.Helper()
+	for i := 1; i <= count; i++ {
+		value := fmt.Sprintf("v%d", i)
+		write(value)
+		require.Eventually(t, func() bool { return secret.Value() == value }, time.Second, time.Millisecond)
+	}
+}
+
+func drain(ch <-chan string) []string {
+	var values []string
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return values
+			}
+			values = append(values, value)
+		default:
+			return values
+		}
+	}
+}
+
+func TestSecret_SubscribeDeliveryPolicies(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []secrets.SubscribeOption
+		expectedValues  []string
+		expectedDropped uint64
+		expectOpen      bool
+	}{
+		{
+			name:            "default disconnects slow subscribers",
+			opts:            nil,
+			expectedValues:  []string{"v1"},
+			expectedDropped: 1,
+			expectOpen:      false,
+		},
+		{
+			name:            "latest value wins",
+			opts:            []secrets.SubscribeOption{secrets.LatestValueWins()},
+			expectedValues:  []string{"v4"},
+			expectedDropped: 3,
+			expectOpen:      true,
+		},
+		{
+			name:            "drop oldest keeps the newest values",
+			opts:            []secrets.SubscribeOption{secrets.DropOldest(2)},
+			expectedValues:  []string{"v3", "v4"},
+			expectedDropped: 2,
+			expectOpen:      true,
+		},
+		{
+			name:            "block with timeout drops after the timeout",
+			opts:            []secrets.SubscribeOption{secrets.BlockWithTimeout(5 * time.Millisecond)},
+			expectedValues:  []string{"v1"},
+			expectedDropped: 3,
+			expectOpen:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loader, mfs, mwf := newMockLoader(t)
+			mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+			secret, err := loader.GetSecret("token")
+			require.NoError(t, err)
+
+			subscription, err := secret.Subscribe(tt.opts...)
+			require.NoError(t, err)
+
+			rotate(t, secret, func(value string) {
+				mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+				mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+			}, 4)
+			// Value is updated just before subscribers are notified
+			time.Sleep(20 * time.Millisecond)
+
+			assert.Equal(t, tt.expectedValues, drain(subscription.Changes()))
+			assert.Equal(t, tt.expectedDropped, subscription.Dropped())
+
+			// A subscriber that is still connected hears about later rotations
+			mfs.WriteFile("/mnt/secrets_store/token", []byte("v5"))
+			mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+			select {
+			case value, ok := <-subscription.Changes():
+				assert.Equal(t, tt.expectOpen, ok)
+				if ok {
+					assert.Equal(t, "v5", value)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for secret change notification")
+			}
+		})
+	}
+}
+
+func TestSecret_SubscribeBlockDeliversToWaitingSubscriber(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	subscription, err := secret.Subscribe(secrets.BlockWithTimeout(time.Second))
+	require.NoError(t, err)
+
+	received := make(chan []string)
+	go func() {
+		var values []string
+		for value := range subscription.Changes() {
+			values = append(values, value)
+			time.Sleep(10 * time.Millisecond) // slow consumer
+			if len(values) == 3 {
+				break
+			}
+		}
+		received <- values
+	}()
+
+	for _, value := range []string{"v1", "v2", "v3"} {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+		require.Eventually(t, func() bool { return secret.Value() == value }, time.Second, time.Millisecond)
+	}
+
+	select {
+	case values := <-received:
+		assert.Equal(t, []string{"v1", "v2", "v3"}, values)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for the slow subscriber")
+	}
+	assert.Zero(t, subscription.Dropped())
+}
+
+func TestSecret_SubscribeBlockQueuesUntilTimeout(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	subscription, err := secret.Subscribe(secrets.BlockWithTimeout(5 * time.Second))
+	require.NoError(t, err)
+
+	// Rotations that arrive while the subscriber is busy wait for their own timeout
+	rotate(t, secret, func(value string) {
+		mfs.WriteFile("/mnt/secrets_store/token", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+		time.Sleep(5 * time.Millisecond)
+	}, 5)
+	time.Sleep(100 * time.Millisecond)
+
+	var values []string
+	for len(values) < 5 {
+		select {
+		case value := <-subscription.Changes():
+			values = append(values, value)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for queued values, received %v", values)
+		}
+	}
+	assert.Equal(t, []string{"v1", "v2", "v3", "v4", "v5"}, values)
+	assert.Zero(t, subscription.Dropped())
+}
+
+func TestSecret_SubscribeBlockDoesNotHoldUpOtherSecrets(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/a", []byte("a0"))
+	mfs.WriteFile("/mnt/secrets_store/b", []byte("b0"))
+	a, err := loader.GetSecret("a")
+	require.NoError(t, err)
+	b, err := loader.GetSecret("b")
+	require.NoError(t, err)
+
+	// Nobody reads from this subscriber, so after the first change it waits for the timeout
+	_, err = a.Subscribe(secrets.BlockWithTimeout(2 * time.Second))
+	require.NoError(t, err)
+	bChanges, err := b.ListenChanges()
+	require.NoError(t, err)
+
+	for _, value := range []string{"a1", "a2"} {
+		mfs.WriteFile("/mnt/secrets_store/a", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/a", fsnotify.Write)
+		require.Eventually(t, func() bool { return a.Value() == value }, time.Second, time.Millisecond)
+	}
+
+	started := time.Now()
+	mfs.WriteFile("/mnt/secrets_store/b", []byte("b1"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/b", fsnotify.Write)
+	select {
+	case value := <-bChanges:
+		assert.Equal(t, "b1", value)
+		assert.Less(t, time.Since(started), 500*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("the rotation of b was held up by the blocked subscriber of a")
+	}
+}
+
+func TestSecret_Unsubscribe(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	first, err := secret.Subscribe()
+	require.NoError(t, err)
+	second, err := secret.Subscribe()
+	require.NoError(t, err)
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"))
+
+	first.Unsubscribe()
+	_, open := <-first.Changes()
+	assert.False(t, open, "channel should be closed after Unsubscribe")
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"), "file should be watched while a subscriber is left")
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	select {
+	case value := <-second.Changes():
+		assert.Equal(t, "v1", value)
+	case <-time.After(time.Second):
+		t.Fatal("remaining subscriber was not notified")
+	}
+
+	second.Unsubscribe()
+	second.Unsubscribe()
+	assert.False(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"), "file should not be watched without subscribers")
+
+	// Subscribing again watches the file again
+	third, err := secret.Subscribe()
+	require.NoError(t, err)
+	assert.True(t, mwf.GetWatcher().IsWatched("/mnt/secrets_store/token"))
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v2"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	select {
+	case value := <-third.Changes():
+		assert.Equal(t, "v2", value)
+	case <-time.After(time.Second):
+		t.Fatal("new subscriber was not notified")
+	}
+}
+
+func TestSecret_ListenChangesContext(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v0"))
+	secret, err := loader.GetSecret("token")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := secret.ListenChangesContext(ctx)
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("v1"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+	select {
+	case value := <-changes:
+		assert.Equal(t, "v1", value)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber was not notified")
+	}
+
+	cancel()
+	select {
+	case _, open := <-changes:
+		assert.False(t, open, "channel should be closed once the context is cancelled")
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after the context was cancelled")
+	}
+	assert.Eventually(t, func() bool {
+		return !mwf.GetWatcher().IsWatched("/mnt/secrets_store/token")
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+)
+
+// CertificateSource serves a TLS certificate loaded from a certificate and a key secret,
+// such as the tls.crt and tls.key of a Kubernetes TLS secret. Both halves are watched as a
+// unit: the certificate is only replaced once they form a valid matching pair again, so a
+// rotation that updates one file before the other never serves a broken pair. The same
+// holds for a PKCS#12 bundle and its password, see NewPKCS12Source.
+type CertificateSource struct {
+	load          func() (*tls.Certificate, []*x509.Certificate, error)
+	current       ConcurrentValue[*tls.Certificate]
+	caCerts       ConcurrentValue[[]*x509.Certificate]
+	err           ConcurrentValue[error]
+	reloadMu      sync.Mutex
+	registrations []*Registration
+	closeOnce     sync.Once
+}
+
+// NewCertificateSource loads the certificate chain and private key stored as PEM under
+// the given keys. It fails if they do not form a valid pair.
+func NewCertificateSource(loader SecretLoader, certKey, keyKey string) (*CertificateSource, error) {
+	cert, err := loader.GetSecret(certKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loader.GetSecret(keyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCertificateSource([]Secret{cert, key}, func() (*tls.Certificate, []*x509.Certificate, error) {
+		certificate, err := tls.X509KeyPair([]byte(cert.Value()), []byte(key.Value()))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidKeyPair, err)
+		}
+		return &certificate, nil, nil
+	})
+}
+
+// newCertificateSource serves the certificate loaded from the given secrets, reloading it
+// when any of them changes
+func newCertificateSource(
+	secrets []Secret, load func() (*tls.Certificate, []*x509.Certificate, error),
+) (*CertificateSource, error) {
+	source := &CertificateSource{load: load}
+	registrations, err := reloadOnChange(secrets, source.reload)
+	if err != nil {
+		return nil, err
+	}
+	source.registrations = registrations
+	return source, nil
+}
+
+// reload loads the current secrets and swaps the certificate in when they are valid.
+// Otherwise the last valid certificate is kept and Err reports why they were rejected.
+func (s *CertificateSource) reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	certificate, caCerts, err := s.load()
+	if err != nil {
+		// Most likely only some of the secrets were rotated so far, the others follow shortly
+		s.err.Set(err)
+		return err
+	}
+
+	s.current.Set(certificate)
+	s.caCerts.Set(caCerts)
+	s.err.Set(nil)
+	return nil
+}
+
+// Certificate returns the current certificate
+func (s *CertificateSource) Certificate() *tls.Certificate {
+	return s.current.Get()
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate, so that servers always present
+// the current certificate
+func (s *CertificateSource) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.current.Get(), nil
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate, so that clients
+// always present the current certificate
+func (s *CertificateSource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return s.current.Get(), nil
+}
+
+// CACertificates returns the CA certificates delivered with the current certificate, such
+// as the chain of a PKCS#12 bundle. They are not part of the chain presented to peers.
+func (s *CertificateSource) CACertificates() []*x509.Certificate {
+	return s.caCerts.Get()
+}
+
+// Err returns why the latest secrets were rejected (ErrInvalidKeyPair for a certificate
+// and key, ErrValidationFailed for a PKCS#12 bundle) while the previous certificate is
+// still served, nil otherwise
+func (s *CertificateSource) Err() error {
+	return s.err.Get()
+}
+
+// Close stops reloading the certificate. The last certificate is still served.
+func (s *CertificateSource) Close() {
+	s.closeOnce.Do(func() {
+		for _, registration := range s.registrations {
+			registration.Remove()
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package secrets_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM string
+	keyPEM  string
+}
+
+func certTemplate(commonName string, notAfter time.Time) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+}
+
+// newTestCert issues a certificate from the template, self-signed when issuer is nil
+func newTestCert(t *testing.T, template *x509.Certificate, issuer *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		keyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+	}
+}
+
+func newTestCA(t *testing.T, commonName string) *testCert {
+	t.Helper()
+	template := certTemplate(commonName, time.Now().Add(24*time.Hour))
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	return newTestCert(t, template, nil)
+}
+
+func TestCertificateSource_SwapsOnlyMatchingPairs(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	first := newTestCert(t, certTemplate("first.example.com", time.Now().Add(time.Hour)), nil)
+	mfs.WriteFile("/mnt/secrets_store/tls/tls.crt", []byte(first.certPEM))
+	mfs.WriteFile("/mnt/secrets_store/tls/tls.key", []byte(first.keyPEM))
+
+	source, err := secrets.NewCertificateSource(loader, "tls/tls.crt", "tls/tls.key")
+	require.NoError(t, err)
+	defer source.Close()
+
+	config := &tls.Config{GetCertificate: source.GetCertificate, GetClientCertificate: source.GetClientCertificate}
+	served, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, served.Certificate[0])
+
+	write := func(name, content string) {
+		mfs.WriteFile("/mnt/secrets_store/tls/"+name, []byte(content))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/tls/"+name, fsnotify.Write)
+	}
+
+	// Only the certificate was rotated so far, the previous pair is still served
+	second := newTestCert(t, certTemplate("second.example.com", time.Now().Add(time.Hour)), nil)
+	write("tls.crt", second.certPEM)
+	require.Eventually(t, func() bool { return source.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, source.Err(), secrets.ErrInvalidKeyPair)
+	served, err = config.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, first.cert.Raw, served.Certificate[0])
+
+	// Once the key follows, the new pair is served
+	write("tls.key", second.keyPEM)
+	require.Eventually(t, func() bool {
+		return source.Certificate().Leaf != nil && source.Certificate().Leaf.Subject.CommonName == "second.example.com"
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, source.Err())
+
+	// After Close the last certificate is still served, but not reloaded anymore
+	source.Close()
+	third := newTestCert(t, certTemplate("third.example.com", time.Now().Add(time.Hour)), nil)
+	write("tls.crt", third.certPEM)
+	write("tls.key", third.keyPEM)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, second.cert.Raw, source.Certificate().Certificate[0])
+}
+
+func TestCertificateSource_RejectsInvalidInitialPair(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	first := newTestCert(t, certTemplate("first.example.com", time.Now().Add(time.Hour)), nil)
+	second := newTestCert(t, certTemplate("second.example.com", time.Now().Add(time.Hour)), nil)
+	mfs.WriteFile("/mnt/secrets_store/tls.crt", []byte(first.certPEM))
+	mfs.WriteFile("/mnt/secrets_store/tls.key", []byte(second.keyPEM))
+
+	_, err := secrets.NewCertificateSource(loader, "tls.crt", "tls.key")
+	assert.ErrorIs(t, err, secrets.ErrInvalidKeyPair)
+
+	_, err = secrets.NewCertificateSource(loader, "tls.crt", "missing.key")
+	assert.ErrorIs(t, err, secrets.ErrSecretNotFound)
+}
@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isHidden reports whether a directory entry is hidden. This also covers the ..data
+// symlink and the timestamped directories written by the Kubernetes atomic writer.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// collectKeys recursively lists the secret keys below the directory identified by dirKey
+func (fsl *fileSecretLoader) collectKeys(dirKey string, entries []fs.DirEntry) ([]string, error) {
+	var keys []string
+	for _, entry := range entries {
+		if isHidden(entry.Name()) {
+			continue
+		}
+
+		key := path.Join(dirKey, entry.Name())
+		entryPath := filepath.Join(fsl.basePath, filepath.FromSlash(key))
+		if !fsl.isDirEntry(entryPath, entry) {
+			keys = append(keys, key)
+			continue
+		}
+
+		children, err := fsl.reader.ReadDir(entryPath)
+		if err != nil {
+			return nil, err
+		}
+		nested, err := fsl.collectKeys(key, children)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, nested...)
+	}
+	return keys, nil
+}
+
+// isDirEntry reports whether the entry is a directory. Nested keys in projected volumes
+// are symlinks into ..data, so symlinks are resolved before deciding.
+func (fsl *fileSecretLoader) isDirEntry(entryPath string, entry fs.DirEntry) bool {
+	if entry.IsDir() {
+		return true
+	}
+	if entry.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+	return fsl.isDir(entryPath)
+}
+
+func (fsl *fileSecretLoader) isDir(dir string) bool {
+	info, err := fsl.reader.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// isVisibleDir reports whether the path is a directory that may hold secrets
+func (fsl *fileSecretLoader) isVisibleDir(dir string) bool {
+	return !isHidden(filepath.Base(dir)) && fsl.isDir(dir)
+}
+
+func (fsl *fileSecretLoader) isWatchedDir(dir string) bool {
+	_, watched := fsl.watchedDirs.Get(filepath.Clean(dir))
+	return watched
+}
+
+// watchTree adds the directory and every visible directory below it to the watcher
+func (fsl *fileSecretLoader) watchTree(dir string) error {
+	dir = filepath.Clean(dir)
+	if err := fsl.watcher.Get().Add(dir); err != nil {
+		return err
+	}
+	fsl.watchedDirs.Set(dir, true)
+
+	entries, err := fsl.reader.ReadDir(dir)
+	if err != nil {
+		// Nothing to descend into (yet), the directory is watched once it shows up
+		return nil
+	}
+
+	for _, entry := range entries {
+		if isHidden(entry.Name()) {
+			continue
+		}
+		child := filepath.Join(dir, entry.Name())
+		if !fsl.isDirEntry(child, entry) {
+			continue
+		}
+		if err := fsl.watchTree(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewatchDirs re-adds the nested directories so their watches follow the directories the
+// paths resolve to now, and picks up directories that were added in the meantime
+func (fsl *fileSecretLoader) rewatchDirs() {
+	basePath := filepath.Clean(fsl.basePath)
+	for dir := range fsl.watchedDirs.CopyMap() {
+		if dir == basePath {
+			continue
+		}
+		_ = fsl.watcher.Get().Remove(dir)
+		if !fsl.isDir(dir) {
+			fsl.watchedDirs.Del(dir)
+			continue
+		}
+		if err := fsl.watcher.Get().Add(dir); err != nil {
+			fsl.watchedDirs.Del(dir)
+			fsl.setError(fmt.Errorf("%w: failed to re-watch directory %s: %w", ErrWatcherFailed, dir, err))
+		}
+	}
+
+	if err := fsl.watchTree(basePath); err != nil {
+		fsl.setError(fmt.Errorf("%w: failed to watch secrets directory: %w", ErrWatcherFailed, err))
+	}
+}
+
+// handleDirCreated starts watching a new directory and loads secrets whose files were
+// created inside it before the watch was in place
+func (fsl *fileSecretLoader) handleDirCreated(dir string) {
+	if err := fsl.watchTree(dir); err != nil {
+		fsl.setError(fmt.Errorf("%w: failed to watch directory %s: %w", ErrWatcherFailed, dir, err))
+	}
+	fsl.reloadUnder(dir)
+}
+
+// handleDirRemoved forgets a removed directory and marks the secrets below it as missing
+func (fsl *fileSecretLoader) handleDirRemoved(dir string) {
+	dir = filepath.Clean(dir)
+	for watched := range fsl.watchedDirs.CopyMap() {
+		if watched == dir || strings.HasPrefix(watched, dir+string(filepath.Separator)) {
+			fsl.watchedDirs.Del(watched)
+		}
+	}
+	fsl.reloadUnder(dir)
+}
+
+// reloadUnder re-reads every loaded secret that lives below the directory
+func (fsl *fileSecretLoader) reloadUnder(dir string) {
+	dirKey, ok := fsl.keyForPath(dir)
+	if !ok {
+		return
+	}
+	for key, secret := range fsl.secrets.CopyMap() {
+		if strings.HasPrefix(key, dirKey+"/") {
+			secret.scheduleReload()
+		}
+	}
+}
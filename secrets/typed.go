@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Decoder turns the value of a secret into a T
+type Decoder[T any] interface {
+	Decode(value string) (T, error)
+}
+
+// DecoderFunc adapts a function to a Decoder, e.g. DecoderFunc[int](strconv.Atoi)
+type DecoderFunc[T any] func(value string) (T, error)
+
+func (f DecoderFunc[T]) Decode(value string) (T, error) {
+	return f(value)
+}
+
+// JSONDecoder decodes secrets holding a JSON document
+func JSONDecoder[T any]() Decoder[T] {
+	return DecoderFunc[T](func(value string) (T, error) {
+		var decoded T
+		err := json.Unmarshal([]byte(value), &decoded)
+		return decoded, err
+	})
+}
+
+// TypedChange is a decoded value of a secret, or the error decoding it
+type TypedChange[T any] struct {
+	Value   T
+	Err     error
+	Version uint64
+}
+
+// decoded is the outcome of decoding one version of a secret
+type decoded[T any] struct {
+	version uint64
+	value   T
+	err     error
+}
+
+// Typed decodes the values of a secret. Every version is decoded once, no matter how often
+// it is read or how many subscribers receive it.
+type Typed[T any] struct {
+	secret  Secret
+	decoder Decoder[T]
+	mu      sync.Mutex
+	cached  *decoded[T]
+}
+
+// NewTyped wraps a secret so its values are decoded with decoder
+func NewTyped[T any](secret Secret, decoder Decoder[T]) *Typed[T] {
+	return &Typed[T]{secret: secret, decoder: decoder}
+}
+
+// Secret returns the wrapped secret
+func (t *Typed[T]) Secret() Secret {
+	return t.secret
+}
+
+// Value returns the decoded current value of the secret
+func (t *Typed[T]) Value() (T, error) {
+	current := t.secret.Current()
+	result := t.decode(current.Version, current.Value)
+	return result.value, result.err
+}
+
+// decode returns the cached outcome for the version, decoding the value if needed
+func (t *Typed[T]) decode(version uint64, value string) decoded[T] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cached != nil && t.cached.version == version {
+		return *t.cached
+	}
+	result := decoded[T]{version: version}
+	result.value, result.err = t.decoder.Decode(value)
+	// Keep the newest version, a slow subscriber may still decode an older one
+	if t.cached == nil || t.cached.version < version {
+		t.cached = &result
+	}
+	return result
+}
+
+// Subscribe delivers every new value of the secret decoded, or the error decoding it.
+// Values are decoded before the options decide what happens when the subscriber falls
+// behind, like for Secret.Subscribe. Only the secrets of a SecretLoader can be subscribed to.
+func (t *Typed[T]) Subscribe(opts ...SubscribeOption) (*Subscription[TypedChange[T]], error) {
+	fs, ok := t.secret.(*fileSecret)
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot subscribe to the decoded values of %T", errors.ErrUnsupported, t.secret)
+	}
+	return subscribe(fs, opts, func(change valueChange) TypedChange[T] {
+		result := t.decode(change.version, change.newValue)
+		return TypedChange[T]{Value: result.value, Err: result.err, Version: result.version}
+	})
+}
@@ -0,0 +1,151 @@
+package secrets_test
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+)
+
+func receiveTyped[T any](t *testing.T, changes <-chan secrets.TypedChange[T]) secrets.TypedChange[T] {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		require.True(t, ok, "typed channel closed")
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for typed change")
+		return secrets.TypedChange[T]{}
+	}
+}
+
+func TestTyped_DecodesOncePerVersion(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/pool-size", []byte("10"))
+	secret, err := loader.GetSecret("pool-size")
+	require.NoError(t, err)
+
+	var decodes atomic.Int32
+	typed := secrets.NewTyped[int](secret, secrets.DecoderFunc[int](func(value string) (int, error) {
+		decodes.Add(1)
+		return strconv.Atoi(value)
+	}))
+
+	for i := 0; i < 3; i++ {
+		value, err := typed.Value()
+		require.NoError(t, err)
+		assert.Equal(t, 10, value)
+	}
+	assert.Equal(t, int32(1), decodes.Load())
+
+	first, err := typed.Subscribe()
+	require.NoError(t, err)
+	second, err := typed.Subscribe()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/pool-size", []byte("20"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/pool-size", fsnotify.Write)
+
+	for _, sub := range []*secrets.Subscription[secrets.TypedChange[int]]{first, second} {
+		change := receiveTyped(t, sub.Changes())
+		require.NoError(t, change.Err)
+		assert.Equal(t, 20, change.Value)
+		assert.Equal(t, uint64(2), change.Version)
+	}
+	value, err := typed.Value()
+	require.NoError(t, err)
+	assert.Equal(t, 20, value)
+	assert.Equal(t, int32(2), decodes.Load(), "the new version is decoded once for all readers")
+
+	// Decoding errors are reported, not swallowed
+	mfs.WriteFile("/mnt/secrets_store/pool-size", []byte("many"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/pool-size", fsnotify.Write)
+
+	change := receiveTyped(t, first.Changes())
+	assert.ErrorIs(t, change.Err, strconv.ErrSyntax)
+	_, err = typed.Value()
+	assert.ErrorIs(t, err, strconv.ErrSyntax)
+
+	first.Unsubscribe()
+	select {
+	case _, open := <-first.Changes():
+		assert.False(t, open)
+	case <-time.After(time.Second):
+		t.Fatal("typed channel was not closed")
+	}
+}
+
+func TestTyped_JSONDecoder(t *testing.T) {
+	type credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{"username":"app","password":"p1"}`))
+	secret, err := loader.GetSecret("db.json")
+	require.NoError(t, err)
+
+	typed := secrets.NewTyped(secret, secrets.JSONDecoder[credentials]())
+	value, err := typed.Value()
+	require.NoError(t, err)
+	assert.Equal(t, credentials{Username: "app", Password: "p1"}, value)
+
+	sub, err := typed.Subscribe()
+	require.NoError(t, err)
+
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{"username":"app","password":"p2"}`))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/db.json", fsnotify.Write)
+	change := receiveTyped(t, sub.Changes())
+	require.NoError(t, change.Err)
+	assert.Equal(t, "p2", change.Value.Password)
+
+	// Closing the secret closes the typed channel
+	loader.Close()
+	select {
+	case _, open := <-sub.Changes():
+		assert.False(t, open)
+	case <-time.After(time.Second):
+		t.Fatal("typed channel was not closed")
+	}
+}
+
+func TestTyped_SubscribeAppliesDeliveryPolicy(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/pool-size", []byte("0"))
+	secret, err := loader.GetSecret("pool-size")
+	require.NoError(t, err)
+
+	typed := secrets.NewTyped[int](secret, secrets.DecoderFunc[int](strconv.Atoi))
+	sub, err := typed.Subscribe(secrets.LatestValueWins())
+	require.NoError(t, err)
+
+	// Nothing is read while the secret rotates, only the latest value is kept
+	for _, value := range []string{"1", "2", "3"} {
+		mfs.WriteFile("/mnt/secrets_store/pool-size", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/pool-size", fsnotify.Write)
+		require.Eventually(t, func() bool { return secret.Value() == value }, time.Second, time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	change := receiveTyped(t, sub.Changes())
+	require.NoError(t, change.Err)
+	assert.Equal(t, 3, change.Value)
+	select {
+	case change := <-sub.Changes():
+		t.Fatalf("unexpected stale change: %v", change)
+	default:
+	}
+	assert.Equal(t, uint64(2), sub.Dropped())
+
+	// Secrets that do not come from a loader cannot be subscribed to
+	_, err = secrets.NewTyped[int](struct{ secrets.Secret }{secret}, secrets.DecoderFunc[int](strconv.Atoi)).Subscribe()
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"slices"
 	"sync"
 )
 
@@ -46,6 +47,13 @@ func (cl *ConcurrentList[T]) Get() []T {
 	return result
 }
 
+// RemoveFunc removes every value for which remove returns true
+func (cl *ConcurrentList[T]) RemoveFunc(remove func(T) bool) {
+	cl.Lock()
+	defer cl.Unlock()
+	cl.values = slices.DeleteFunc(cl.values, remove)
+}
+
 // Set Replace the entire list with a new one
 func (cl *ConcurrentList[T]) Set(newList []T) {
 	cl.Lock()
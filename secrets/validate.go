@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Validator checks a new value of a secret before it is published. Returning an error
+// rejects the value.
+type Validator func(value string) error
+
+// WithValidator validates every value of every secret before it is published. A rejected
+// value is not published, the last good value is kept and Err reports ErrValidationFailed
+// until a later file event brings a valid value.
+func WithValidator(validator Validator) Option {
+	return func(fsl *fileSecretLoader) {
+		fsl.secretConfig.validators = append(slices.Clip(fsl.secretConfig.validators), validator)
+	}
+}
+
+// WithSecretValidator is like WithValidator, for a single secret. It runs after the
+// validators of the loader. Validators passed to later GetSecret calls for the same secret
+// are added to the ones it already has, a validator is never removed.
+func WithSecretValidator(validator Validator) SecretOption {
+	return func(c *secretConfig) {
+		c.validators = append(slices.Clip(c.validators), validator)
+	}
+}
+
+// withFormat rejects values that are not valid documents of the format. Unlike
+// WithSecretValidator, passing it again for the same format does not add another check.
+func withFormat(format Format) SecretOption {
+	return func(c *secretConfig) {
+		if !slices.Contains(c.formats, format) {
+			c.formats = append(slices.Clip(c.formats), format)
+		}
+	}
+}
+
+// allValidators returns the validators of the config, followed by the checks of the
+// document formats
+func (c secretConfig) allValidators() []Validator {
+	validators := slices.Clip(c.validators)
+	for _, format := range c.formats {
+		validators = append(validators, ValidFormat(format))
+	}
+	return validators
+}
+
+// validate runs the validators in order and returns the first rejection
+func validate(validators []Validator, key, value string) error {
+	for _, validator := range validators {
+		if err := validator(value); err != nil {
+			return fmt.Errorf("%w for secret %s: %w", ErrValidationFailed, key, err)
+		}
+	}
+	return nil
+}
+
+// clearError forgets the current error of the secret if it matches target
+func (fs *fileSecret) clearError(target error) {
+	if errors.Is(fs.err.Get(), target) {
+		fs.err.Set(nil)
+	}
+}
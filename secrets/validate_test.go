@@ -0,0 +1,139 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func validJSON(value string) error {
+	if !json.Valid([]byte(value)) {
+		return errors.New("invalid JSON")
+	}
+	return nil
+}
+
+func TestSecret_ValidatorRejectsBadRotations(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/config.json", []byte(`{"v":1}`))
+	secret, err := loader.GetSecret("config.json", secrets.WithSecretValidator(validJSON))
+	require.NoError(t, err)
+	changes, err := secret.ListenChanges()
+	require.NoError(t, err)
+
+	write := func(value string) {
+		mfs.WriteFile("/mnt/secrets_store/config.json", []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/config.json", fsnotify.Write)
+	}
+
+	// A truncated write is rejected, the last good value stays in place
+	write(`{"v":`)
+	require.Eventually(t, func() bool { return secret.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, secret.Err(), secrets.ErrValidationFailed)
+	assert.ErrorContains(t, secret.Err(), "invalid JSON")
+	assert.Equal(t, `{"v":1}`, secret.Value())
+	assert.Equal(t, uint64(1), secret.Version())
+
+	// The next event validates again
+	write(`{"v":2}`)
+	select {
+	case value := <-changes:
+		assert.Equal(t, `{"v":2}`, value)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for secret change notification")
+	}
+	assert.NoError(t, secret.Err())
+
+	// Going back to the current value after a rejection clears the error as well
+	write(`{"v":`)
+	require.Eventually(t, func() bool { return secret.Err() != nil }, time.Second, time.Millisecond)
+	write(`{"v":2}`)
+	require.Eventually(t, func() bool { return secret.Err() == nil }, time.Second, time.Millisecond)
+	assert.Empty(t, drain(changes))
+}
+
+func TestSecretLoader_WithValidator(t *testing.T) {
+	notEmpty := func(value string) error {
+		if value == "" {
+			return errors.New("empty value")
+		}
+		return nil
+	}
+	loader, mfs, _ := newMockLoader(t, secrets.WithValidator(notEmpty))
+	mfs.WriteFile("/mnt/secrets_store/empty", []byte(""))
+	mfs.WriteFile("/mnt/secrets_store/config.json", []byte(`{`))
+
+	_, err := loader.GetSecret("empty")
+	assert.ErrorIs(t, err, secrets.ErrValidationFailed)
+
+	// Validators of the secret run in addition to the ones of the loader
+	_, err = loader.GetSecret("config.json", secrets.WithSecretValidator(validJSON))
+	assert.ErrorIs(t, err, secrets.ErrValidationFailed)
+	assert.ErrorContains(t, err, "invalid JSON")
+	_, err = loader.GetSecret("config.json")
+	assert.NoError(t, err)
+}
+
+func TestSecretLoader_RequiredSecretsAreValidated(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.WriteFile("/mnt/secrets_store/config.json", []byte(`{`))
+
+	_, err := secrets.NewFileSecretLoader(context.Background(),
+		secrets.WithBasePath("/mnt/secrets_store"),
+		secrets.WithFileReader(mfs),
+		secrets.WithWatcherFactory(mocks.NewMockWatcherFactory()),
+		secrets.WithValidator(validJSON),
+		secrets.WithRequiredSecrets("config.json"),
+	)
+
+	var required *secrets.RequiredSecretsError
+	require.ErrorAs(t, err, &required)
+	assert.Contains(t, required.Invalid, "config.json")
+	assert.ErrorIs(t, required.Invalid["config.json"], secrets.ErrValidationFailed)
+}
+
+func TestSecret_ValidatorsKeptByLaterOptions(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/config.json", []byte(`{"v":1}`))
+	mfs.WriteFile("/mnt/secrets_store/db.json", []byte(`{"password":"p1"}`))
+
+	write := func(key, value string) {
+		mfs.WriteFile("/mnt/secrets_store/"+key, []byte(value))
+		mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/"+key, fsnotify.Write)
+	}
+
+	secret, err := loader.GetSecret("config.json", secrets.WithSecretValidator(validJSON))
+	require.NoError(t, err)
+	_, err = loader.GetSecret("config.json", secrets.WithSecretMaxSize(1<<20))
+	require.NoError(t, err)
+	_, err = secret.Subscribe(secrets.LatestValueWins())
+	require.NoError(t, err)
+
+	write("config.json", "not json")
+	require.Eventually(t, func() bool { return secret.Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, secret.Err(), secrets.ErrValidationFailed)
+	assert.Equal(t, `{"v":1}`, secret.Value())
+
+	// The format check of a document is kept as well
+	document, err := loader.GetJSONDocument("db.json")
+	require.NoError(t, err)
+	_, err = loader.GetSecret("db.json", secrets.WithSecretHistory(2, 0))
+	require.NoError(t, err)
+	_, err = document.Secret().Subscribe(secrets.LatestValueWins())
+	require.NoError(t, err)
+
+	write("db.json", "{broken")
+	require.Eventually(t, func() bool { return document.Secret().Err() != nil }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, document.Secret().Err(), secrets.ErrDecodeFailed)
+	assert.Equal(t, `{"password":"p1"}`, document.Secret().Value())
+}
@@ -0,0 +1,111 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MissingSecretsError is returned by WaitForSecrets when the context ends before all secrets
+// became available
+type MissingSecretsError struct {
+	// Keys lists the secrets that were still missing or empty
+	Keys []string
+	// Err is the error of the context
+	Err error
+}
+
+func (e *MissingSecretsError) Error() string {
+	return fmt.Sprintf("secrets still missing: %s: %v", strings.Join(e.Keys, ", "), e.Err)
+}
+
+func (e *MissingSecretsError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForSecrets blocks until the files of all given keys exist and are not empty, which
+// covers secret stores that are populated after the process started. Every watcher event
+// triggers a new check. When ctx ends first, a *MissingSecretsError lists the missing keys.
+func (fsl *fileSecretLoader) WaitForSecrets(ctx context.Context, keys ...string) error {
+	cleaned := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key, err := cleanSecretKey(key)
+		if err != nil {
+			return err
+		}
+		cleaned = append(cleaned, key)
+	}
+
+	for {
+		if fsl.isClosed.Get() {
+			return ErrLoaderClosed
+		}
+
+		// Taken before checking, so that a change right after the check is not lost
+		changed := fsl.changeSignal()
+
+		missing := fsl.missingSecrets(cleaned)
+		if len(missing) == 0 {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return &MissingSecretsError{Keys: missing, Err: ctx.Err()}
+		case <-fsl.ctx.Done():
+			return ErrLoaderClosed
+		}
+	}
+}
+
+// missingSecrets returns the keys whose file does not exist or is still empty. The dotenv
+// files are only read when a key has no file of its own, and then only once.
+func (fsl *fileSecretLoader) missingSecrets(keys []string) []string {
+	var missing []string
+	var dotenv map[string]string
+	for _, key := range keys {
+		if fsl.hasContent(filepath.Join(fsl.basePath, filepath.FromSlash(key))) {
+			continue
+		}
+		if dotenv == nil {
+			dotenv = fsl.dotenvVariables()
+		}
+		if dotenv[key] != "" {
+			continue
+		}
+		missing = append(missing, key)
+	}
+	return missing
+}
+
+// hasContent reports whether the file exists and is not empty without reading it, unless
+// it reports no size like the files of procfs. Those are read up to their first byte.
+func (fsl *fileSecretLoader) hasContent(path string) bool {
+	info, err := fsl.reader.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if info.Size() > 0 {
+		return true
+	}
+	content, err := readSecretFile(fsl.reader, path, 1)
+	return len(content) > 0 || errors.Is(err, ErrSecretTooLarge)
+}
+
+// changeSignal returns a channel that is closed on the next change seen by the watcher
+func (fsl *fileSecretLoader) changeSignal() <-chan struct{} {
+	fsl.changedMu.Lock()
+	defer fsl.changedMu.Unlock()
+	return fsl.changed
+}
+
+// signalChange wakes up every WaitForSecrets call
+func (fsl *fileSecretLoader) signalChange() {
+	fsl.changedMu.Lock()
+	defer fsl.changedMu.Unlock()
+	close(fsl.changed)
+	fsl.changed = make(chan struct{})
+}
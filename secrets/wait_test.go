@@ -0,0 +1,128 @@
+package secrets_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stable-io/commons-go/secrets"
+	"github.com/stable-io/commons-go/secrets/mocks"
+)
+
+func TestSecretLoader_WaitForSecrets(t *testing.T) {
+	loader, mfs, mwf := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("key"))
+
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		result <- loader.WaitForSecrets(ctx, "api-key", "db/password", "token")
+	}()
+
+	// An empty file does not count as available yet
+	mfs.WriteFile("/mnt/secrets_store/token", []byte(""))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Create)
+	mfs.WriteFile("/mnt/secrets_store/db/password", []byte("password"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/db", fsnotify.Create)
+
+	select {
+	case err := <-result:
+		t.Fatalf("returned before all secrets were available: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mfs.WriteFile("/mnt/secrets_store/token", []byte("token"))
+	mwf.GetWatcher().SimulateEvent("/mnt/secrets_store/token", fsnotify.Write)
+
+	select {
+	case err := <-result:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for WaitForSecrets to return")
+	}
+
+	secret, err := loader.GetSecret("db/password")
+	require.NoError(t, err)
+	assert.Equal(t, "password", secret.Value())
+}
+
+func TestSecretLoader_WaitForSecretsTimeout(t *testing.T) {
+	loader, mfs, _ := newMockLoader(t)
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("key"))
+	mfs.WriteFile("/mnt/secrets_store/empty", []byte(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := loader.WaitForSecrets(ctx, "api-key", "empty", "missing")
+
+	var missingErr *secrets.MissingSecretsError
+	require.ErrorAs(t, err, &missingErr)
+	assert.Equal(t, []string{"empty", "missing"}, missingErr.Keys)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSecretLoader_WaitForSecretsRealFilesystem(t *testing.T) {
+	dir := t.TempDir()
+
+	loader, err := secrets.NewFileSecretLoader(context.Background(), secrets.WithBasePath(dir))
+	require.NoError(t, err)
+	defer loader.Close()
+
+	go func() {
+		// Populated by a sidecar shortly after startup
+		time.Sleep(50 * time.Millisecond)
+		_ = os.MkdirAll(filepath.Join(dir, "vault"), 0o755)
+		_ = os.WriteFile(filepath.Join(dir, "vault", "token"), []byte("token"), 0o644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, loader.WaitForSecrets(ctx, "vault/token"))
+}
+
+// countingReader counts the reads of every file
+type countingReader struct {
+	*mocks.MockFileSystem
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (r *countingReader) ReadFile(path string) ([]byte, error) {
+	r.mu.Lock()
+	r.reads[path]++
+	r.mu.Unlock()
+	return r.MockFileSystem.ReadFile(path)
+}
+
+func (r *countingReader) count(path string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads[path]
+}
+
+func TestSecretLoader_WaitForSecretsChecksWithoutReading(t *testing.T) {
+	mfs := mocks.NewMockFileSystem()
+	t.Cleanup(mfs.Close)
+	mfs.CreateDir("/mnt/secrets_store")
+	reader := &countingReader{MockFileSystem: mfs, reads: make(map[string]int)}
+	loader, _, _ := newMockLoader(t, secrets.WithFileReader(reader), secrets.WithDotenvFile("app.env"))
+
+	mfs.WriteFile("/mnt/secrets_store/api-key", []byte("key"))
+	mfs.WriteFile("/mnt/secrets_store/app.env", []byte("DB_USER=app\nDB_PASSWORD=secret\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, loader.WaitForSecrets(ctx, "api-key", "DB_USER", "DB_PASSWORD"))
+
+	assert.Zero(t, reader.count("/mnt/secrets_store/api-key"))
+	assert.Equal(t, 1, reader.count("/mnt/secrets_store/app.env"), "the dotenv file is parsed once per check")
+}